@@ -0,0 +1,225 @@
+package base
+
+import (
+	"fmt"
+	"gonum.org/v1/gonum/floats"
+	"math"
+)
+
+/* Updater */
+
+// Updater updates a matrix of parameters row by row, where states of the
+// optimizer are kept for each parameter. Different rows could be updated in
+// parallel.
+type Updater interface {
+	// SetLr sets the learning rate.
+	SetLr(lr float64)
+	// Update updates the i-th row of parameters (param) by the descent
+	// direction (grad), which is the negative gradient of the loss.
+	Update(i int, param []float64, grad []float64)
+	// State returns the state of the optimizer.
+	State() UpdaterState
+	// SetState restores the state of the optimizer.
+	SetState(state UpdaterState)
+}
+
+// UpdaterState is the state of an optimizer, which is saved in checkpoints.
+type UpdaterState struct {
+	Matrices [][][]float64 // Matrices of states, e.g. moments of Adam
+	Steps    []int         // The number of steps of each row
+}
+
+// NewUpdater creates an updater for a matrix of parameters (rows × cols).
+// Params:
+//   Optimizer - The optimizer ('sgd', 'momentum', 'adagrad', 'adam'). Default is 'sgd'.
+//   Momentum  - The momentum of SGD with momentum. Default is 0.9.
+// It panics if the optimizer is unknown, so that names in a parameter grid
+// should be checked before searching.
+func NewUpdater(params Params, rows, cols int) Updater {
+	switch name := params.GetString(Optimizer, SGD); name {
+	case SGD:
+		return new(sgdUpdater)
+	case MomentumSGD:
+		return &momentumUpdater{
+			momentum: params.GetFloat64(Momentum, 0.9),
+			velocity: MakeMatrix(rows, cols),
+		}
+	case AdaGrad:
+		return &adaGradUpdater{sumSquare: MakeMatrix(rows, cols)}
+	case Adam:
+		return &adamUpdater{
+			moment1: MakeMatrix(rows, cols),
+			moment2: MakeMatrix(rows, cols),
+			steps:   make([]int, rows),
+		}
+	default:
+		panic(fmt.Sprintf("Unknown optimizer: %v", name))
+	}
+}
+
+// sgdUpdater updates parameters by SGD:
+//   \theta <- \theta + \eta g
+type sgdUpdater struct {
+	lr float64
+}
+
+func (updater *sgdUpdater) SetLr(lr float64) {
+	updater.lr = lr
+}
+
+func (updater *sgdUpdater) Update(i int, param []float64, grad []float64) {
+	floats.AddScaled(param, updater.lr, grad)
+}
+
+func (updater *sgdUpdater) State() UpdaterState {
+	return UpdaterState{}
+}
+
+func (updater *sgdUpdater) SetState(state UpdaterState) {}
+
+// momentumUpdater updates parameters by SGD with momentum:
+//   v <- \mu v + g
+//   \theta <- \theta + \eta v
+type momentumUpdater struct {
+	lr       float64
+	momentum float64
+	velocity [][]float64
+}
+
+func (updater *momentumUpdater) SetLr(lr float64) {
+	updater.lr = lr
+}
+
+func (updater *momentumUpdater) Update(i int, param []float64, grad []float64) {
+	velocity := updater.velocity[i]
+	for j := range param {
+		velocity[j] = updater.momentum*velocity[j] + grad[j]
+		param[j] += updater.lr * velocity[j]
+	}
+}
+
+func (updater *momentumUpdater) State() UpdaterState {
+	return UpdaterState{Matrices: [][][]float64{updater.velocity}}
+}
+
+func (updater *momentumUpdater) SetState(state UpdaterState) {
+	updater.velocity = state.Matrices[0]
+}
+
+// adaGradUpdater updates parameters by AdaGrad:
+//   G <- G + g^2
+//   \theta <- \theta + \eta g / (\sqrt{G} + \epsilon)
+type adaGradUpdater struct {
+	lr        float64
+	sumSquare [][]float64
+}
+
+func (updater *adaGradUpdater) SetLr(lr float64) {
+	updater.lr = lr
+}
+
+func (updater *adaGradUpdater) Update(i int, param []float64, grad []float64) {
+	sumSquare := updater.sumSquare[i]
+	for j := range param {
+		sumSquare[j] += grad[j] * grad[j]
+		param[j] += updater.lr * grad[j] / (math.Sqrt(sumSquare[j]) + 1e-8)
+	}
+}
+
+func (updater *adaGradUpdater) State() UpdaterState {
+	return UpdaterState{Matrices: [][][]float64{updater.sumSquare}}
+}
+
+func (updater *adaGradUpdater) SetState(state UpdaterState) {
+	updater.sumSquare = state.Matrices[0]
+}
+
+// adamUpdater updates parameters by Adam, where the number of steps is counted
+// for each row:
+//   m <- \beta_1 m + (1-\beta_1) g
+//   v <- \beta_2 v + (1-\beta_2) g^2
+//   \theta <- \theta + \eta \hat{m} / (\sqrt{\hat{v}} + \epsilon)
+type adamUpdater struct {
+	lr      float64
+	moment1 [][]float64
+	moment2 [][]float64
+	steps   []int
+}
+
+const (
+	adamBeta1   = 0.9
+	adamBeta2   = 0.999
+	adamEpsilon = 1e-8
+)
+
+func (updater *adamUpdater) SetLr(lr float64) {
+	updater.lr = lr
+}
+
+func (updater *adamUpdater) Update(i int, param []float64, grad []float64) {
+	moment1, moment2 := updater.moment1[i], updater.moment2[i]
+	updater.steps[i]++
+	correction1 := 1 - math.Pow(adamBeta1, float64(updater.steps[i]))
+	correction2 := 1 - math.Pow(adamBeta2, float64(updater.steps[i]))
+	for j := range param {
+		moment1[j] = adamBeta1*moment1[j] + (1-adamBeta1)*grad[j]
+		moment2[j] = adamBeta2*moment2[j] + (1-adamBeta2)*grad[j]*grad[j]
+		param[j] += updater.lr * (moment1[j] / correction1) / (math.Sqrt(moment2[j]/correction2) + adamEpsilon)
+	}
+}
+
+func (updater *adamUpdater) State() UpdaterState {
+	return UpdaterState{Matrices: [][][]float64{updater.moment1, updater.moment2}, Steps: updater.steps}
+}
+
+func (updater *adamUpdater) SetState(state UpdaterState) {
+	updater.moment1, updater.moment2 = state.Matrices[0], state.Matrices[1]
+	updater.steps = state.Steps
+}
+
+/* Learning Rate Schedule */
+
+// FuncLrSchedule returns the learning rate of an epoch, which starts from 0.
+type FuncLrSchedule func(epoch int) float64
+
+// NewLrSchedule creates a learning rate schedule from the initial learning
+// rate (lr) for nEpochs epochs. Params:
+//   LrSchedule - The schedule ('constant', 'step', 'exponential', 'cosine').
+//                Default is 'constant'.
+//   LrDecay    - The decay rate of 'step' or 'exponential'. Default is 0.1 for
+//                'step' and 0.95 for 'exponential'.
+//   LrStepSize - The number of epochs between decays of 'step'. Default is 10.
+//                Values less than 1 are treated as 1.
+// It panics if the schedule is unknown, so that names in a parameter grid
+// should be checked before searching.
+func NewLrSchedule(params Params, lr float64, nEpochs int) FuncLrSchedule {
+	switch name := params.GetString(LrSchedule, ConstantLr); name {
+	case ConstantLr:
+		return func(epoch int) float64 {
+			return lr
+		}
+	case StepLr:
+		decay := params.GetFloat64(LrDecay, 0.1)
+		stepSize := params.GetInt(LrStepSize, 10)
+		if stepSize < 1 {
+			stepSize = 1
+		}
+		return func(epoch int) float64 {
+			// \eta_0 \gamma^{\lfloor t/s \rfloor}
+			return lr * math.Pow(decay, float64(epoch/stepSize))
+		}
+	case ExponentialLr:
+		decay := params.GetFloat64(LrDecay, 0.95)
+		return func(epoch int) float64 {
+			// \eta_0 \gamma^t
+			return lr * math.Pow(decay, float64(epoch))
+		}
+	case CosineLr:
+		return func(epoch int) float64 {
+			// \eta_0 (1 + \cos(\pi t/T)) / 2
+			return lr * (1 + math.Cos(math.Pi*float64(epoch)/float64(nEpochs))) / 2
+		}
+	default:
+		panic(fmt.Sprintf("Unknown learning rate schedule: %v", name))
+	}
+}
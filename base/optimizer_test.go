@@ -0,0 +1,107 @@
+package base
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestNewUpdater(t *testing.T) {
+	// SGD
+	updater := NewUpdater(nil, 1, 2)
+	updater.SetLr(0.1)
+	param := []float64{1, 2}
+	updater.Update(0, param, []float64{1, -1})
+	assert.InDeltaSlice(t, []float64{1.1, 1.9}, param, 1e-12)
+	// SGD with momentum
+	updater = NewUpdater(Params{Optimizer: MomentumSGD, Momentum: 0.5}, 1, 1)
+	updater.SetLr(0.1)
+	param = []float64{0}
+	updater.Update(0, param, []float64{1})
+	updater.Update(0, param, []float64{1})
+	assert.InDelta(t, 0.1+0.15, param[0], 1e-12)
+	// AdaGrad
+	updater = NewUpdater(Params{Optimizer: AdaGrad}, 1, 1)
+	updater.SetLr(0.1)
+	param = []float64{0}
+	updater.Update(0, param, []float64{2})
+	assert.InDelta(t, 0.1, param[0], 1e-6)
+	// Adam takes steps of the learning rate at first
+	updater = NewUpdater(Params{Optimizer: Adam}, 2, 1)
+	updater.SetLr(0.1)
+	param = []float64{0}
+	updater.Update(1, param, []float64{-5})
+	assert.InDelta(t, -0.1, param[0], 1e-6)
+	// Unknown optimizer
+	assert.Panics(t, func() { NewUpdater(Params{Optimizer: ParamString("unknown")}, 1, 1) })
+}
+
+func TestUpdater_Minimize(t *testing.T) {
+	// Minimize (x-1)^2 + (y+2)^2
+	for _, name := range []ParamString{SGD, MomentumSGD, AdaGrad, Adam} {
+		updater := NewUpdater(Params{Optimizer: name}, 1, 2)
+		updater.SetLr(0.1)
+		param := []float64{0, 0}
+		grad := make([]float64, 2)
+		for i := 0; i < 1000; i++ {
+			grad[0] = -2 * (param[0] - 1)
+			grad[1] = -2 * (param[1] + 2)
+			updater.Update(0, param, grad)
+		}
+		assert.InDeltaSlice(t, []float64{1, -2}, param, 1e-2, string(name))
+	}
+}
+
+func TestUpdater_State(t *testing.T) {
+	for _, name := range []ParamString{SGD, MomentumSGD, AdaGrad, Adam} {
+		updater := NewUpdater(Params{Optimizer: name}, 1, 2)
+		updater.SetLr(0.1)
+		param := []float64{0, 0}
+		updater.Update(0, param, []float64{1, 2})
+		// Save the state
+		buf := bytes.NewBuffer(nil)
+		if err := gob.NewEncoder(buf).Encode(updater.State()); err != nil {
+			t.Fatal(err)
+		}
+		var state UpdaterState
+		if err := gob.NewDecoder(buf).Decode(&state); err != nil {
+			t.Fatal(err)
+		}
+		// Restored optimizer takes the same step
+		restored := NewUpdater(Params{Optimizer: name}, 1, 2)
+		restored.SetLr(0.1)
+		restored.SetState(state)
+		restoredParam := append([]float64{}, param...)
+		updater.Update(0, param, []float64{1, 2})
+		restored.Update(0, restoredParam, []float64{1, 2})
+		assert.Equal(t, param, restoredParam, string(name))
+	}
+}
+
+func TestNewLrSchedule(t *testing.T) {
+	// Constant
+	schedule := NewLrSchedule(nil, 0.1, 10)
+	assert.Equal(t, 0.1, schedule(0))
+	assert.Equal(t, 0.1, schedule(9))
+	// Step
+	schedule = NewLrSchedule(Params{LrSchedule: StepLr, LrDecay: 0.5, LrStepSize: 3}, 0.1, 10)
+	assert.InDelta(t, 0.1, schedule(2), 1e-12)
+	assert.InDelta(t, 0.05, schedule(3), 1e-12)
+	assert.InDelta(t, 0.025, schedule(6), 1e-12)
+	// Step sizes less than 1 are treated as 1
+	schedule = NewLrSchedule(Params{LrSchedule: StepLr, LrDecay: 0.5, LrStepSize: 0}, 0.1, 10)
+	assert.InDelta(t, 0.05, schedule(1), 1e-12)
+	// Exponential
+	schedule = NewLrSchedule(Params{LrSchedule: ExponentialLr, LrDecay: 0.5}, 0.1, 10)
+	assert.InDelta(t, 0.1, schedule(0), 1e-12)
+	assert.InDelta(t, 0.0125, schedule(3), 1e-12)
+	// Cosine
+	schedule = NewLrSchedule(Params{LrSchedule: CosineLr}, 0.1, 10)
+	assert.InDelta(t, 0.1, schedule(0), 1e-12)
+	assert.InDelta(t, 0.05, schedule(5), 1e-12)
+	assert.InDelta(t, 0.1*(1+math.Cos(math.Pi*0.9))/2, schedule(9), 1e-12)
+	// Unknown schedule
+	assert.Panics(t, func() { NewLrSchedule(Params{LrSchedule: ParamString("unknown")}, 0.1, 10) })
+}
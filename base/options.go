@@ -1,23 +1,51 @@
 package base
 
-import "runtime"
+import (
+	"context"
+	"log"
+	"runtime"
+	"time"
+)
 
 // FitOptions defined options used in fitting.
 type FitOptions struct {
-	Verbose  bool // Verbose switch
-	Diagnose bool
-	NJobs    int // Number of jobs
+	Verbose         bool // Verbose switch
+	Diagnose        bool
+	NJobs           int             // Number of jobs
+	EarlyStopper    EarlyStopper    // Early stopper, nil if disabled
+	Callbacks       []EpochCallback // Callbacks called after each epoch
+	Context         context.Context // Fitting stops between epochs if canceled
+	CheckpointFile  string          // File to save checkpoints, empty if disabled
+	CheckpointEvery int             // Save a checkpoint every n epochs
+	ResumeFile      string          // Checkpoint to resume from, empty if disabled
+	Interrupted     bool            // Set by iterative models if fitting is stopped by the context
+	Hogwild         bool            // Run SGD by Hogwild over NJobs jobs, which isn't reproducible
 }
 
-// NewCVOptions creates a FitOptions from FitOption.
+// EarlyStopper stops fitting early. Iterative models call Stop() after each
+// epoch and call Restore() at the end of fitting.
+type EarlyStopper interface {
+	// Stop returns true if fitting should be stopped after the epoch-th epoch.
+	Stop(model interface{}, epoch int) bool
+	// Restore restores the best parameters to the model.
+	Restore(model interface{})
+}
+
+// NewFitOptions creates a FitOptions from FitOption. Progress is logged by
+// LogEpoch if verbose. Verbose is false by default, which was true before it
+// took effect, so that fitting is silent unless WithVerbose(true) is given.
 func NewFitOptions(setters []FitOption) *FitOptions {
 	options := new(FitOptions)
 	options.NJobs = runtime.NumCPU()
 	options.Diagnose = true
-	options.Verbose = true
+	options.Verbose = false
+	options.Context = context.Background()
 	for _, setter := range setters {
 		setter(options)
 	}
+	if options.Verbose {
+		options.Callbacks = append(options.Callbacks, LogEpoch)
+	}
 	return options
 }
 
@@ -31,6 +59,51 @@ func WithVerbose(verbose bool) FitOption {
 	}
 }
 
+// WithCallback adds a callback called after each epoch.
+func WithCallback(callback EpochCallback) FitOption {
+	return func(options *FitOptions) {
+		options.Callbacks = append(options.Callbacks, callback)
+	}
+}
+
+// EpochCallback is called by iterative models after each epoch with the
+// epoch number starting from 1, the training loss and the time elapsed since
+// fitting started.
+type EpochCallback func(epoch int, loss float64, elapsed time.Duration)
+
+// LogEpoch is a callback logging the epoch number, the training loss and the
+// elapsed time.
+func LogEpoch(epoch int, loss float64, elapsed time.Duration) {
+	log.Printf("epoch %d: loss = %.6f, elapsed = %v", epoch, loss, elapsed)
+}
+
+// WithContext sets the context. Iterative models stop fitting between epochs
+// if the context is canceled.
+func WithContext(ctx context.Context) FitOption {
+	return func(options *FitOptions) {
+		options.Context = ctx
+	}
+}
+
+// WithCheckpoint saves a checkpoint to the file every n epochs. A checkpoint
+// contains model parameters, states of the random generator and optimizers, and
+// the number of finished epochs.
+func WithCheckpoint(fileName string, every int) FitOption {
+	return func(options *FitOptions) {
+		options.CheckpointFile = fileName
+		options.CheckpointEvery = every
+	}
+}
+
+// WithResume resumes fitting from a checkpoint. The model should be fitted with
+// the same training set and hyper-parameters as the checkpoint. Fitting starts
+// from scratch if the checkpoint couldn't be loaded.
+func WithResume(fileName string) FitOption {
+	return func(options *FitOptions) {
+		options.ResumeFile = fileName
+	}
+}
+
 // WithNJobs sets the number of jobs.
 func WithNJobs(nJobs int) FitOption {
 	return func(options *FitOptions) {
@@ -38,6 +111,15 @@ func WithNJobs(nJobs int) FitOption {
 	}
 }
 
+// WithHogwild sets the Hogwild switch. SGD-based models update parameters by
+// NJobs jobs without locks if enabled, which is faster but not reproducible.
+// SGD is serial by default.
+func WithHogwild(hogwild bool) FitOption {
+	return func(options *FitOptions) {
+		options.Hogwild = hogwild
+	}
+}
+
 type CVOptions struct {
 	FitOptions
 	Seed int64
@@ -45,12 +127,13 @@ type CVOptions struct {
 
 type CVOption func(options *CVOptions)
 
-// NewCVOptions creates a FitOptions from FitOption.
+// NewCVOptions creates a FitOptions from FitOption. Verbose is false by
+// default, same as NewFitOptions.
 func NewCVOptions(setters []CVOption) *CVOptions {
 	options := new(CVOptions)
 	options.NJobs = runtime.NumCPU()
 	options.Diagnose = true
-	options.Verbose = true
+	options.Verbose = false
 	for _, setter := range setters {
 		setter(options)
 	}
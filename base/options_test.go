@@ -0,0 +1,36 @@
+package base
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewFitOptions(t *testing.T) {
+	// Silent and without Hogwild by default
+	options := NewFitOptions(nil)
+	assert.False(t, options.Verbose)
+	assert.False(t, options.Hogwild)
+	assert.Equal(t, 0, len(options.Callbacks))
+	// Hogwild
+	options = NewFitOptions([]FitOption{WithHogwild(true)})
+	assert.True(t, options.Hogwild)
+	// Log progress if verbose
+	options = NewFitOptions([]FitOption{WithVerbose(true)})
+	assert.Equal(t, 1, len(options.Callbacks))
+	// Callbacks
+	epochs := make([]int, 0)
+	options = NewFitOptions([]FitOption{WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+		epochs = append(epochs, epoch)
+	})})
+	for _, callback := range options.Callbacks {
+		callback(1, 0, 0)
+	}
+	assert.Equal(t, []int{1}, epochs)
+}
+
+func TestNewCVOptions(t *testing.T) {
+	// Silent by default, same as NewFitOptions
+	options := NewCVOptions(nil)
+	assert.False(t, options.Verbose)
+}
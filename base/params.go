@@ -1,6 +1,7 @@
 package base
 
 import (
+	"encoding/gob"
 	"log"
 	"reflect"
 )
@@ -32,6 +33,15 @@ const (
 	Target        ParamName = "loss"
 	Shrinkage     ParamName = "shrinkage"
 	Alpha         ParamName = "alpha"
+	BatchSize     ParamName = "batch_size"
+	Optimizer     ParamName = "optimizer"
+	Momentum      ParamName = "momentum"
+	LrSchedule    ParamName = "lr_schedule"
+	LrDecay       ParamName = "lr_decay"
+	LrStepSize    ParamName = "lr_step_size"
+	Solver        ParamName = "solver"
+	CGSteps       ParamName = "cg_steps"
+	FoldInEpochs  ParamName = "fold_in_epochs"
 )
 
 /* ParamString */
@@ -39,6 +49,11 @@ const (
 // ParamString is the string type of hyper-parameter values.
 type ParamString string
 
+func init() {
+	// Register ParamString to encode Params by gob
+	gob.Register(ParamString(""))
+}
+
 // Predefined values for hyper-parameter Type.
 const (
 	Basic    ParamString = "basic"
@@ -60,6 +75,28 @@ const (
 	MSD     ParamString = "msd"
 )
 
+// Predefined values for hyper-parameter Optimizer.
+const (
+	SGD         ParamString = "sgd"
+	MomentumSGD ParamString = "momentum"
+	AdaGrad     ParamString = "adagrad"
+	Adam        ParamString = "adam"
+)
+
+// Predefined values for hyper-parameter LrSchedule.
+const (
+	ConstantLr    ParamString = "constant"
+	StepLr        ParamString = "step"
+	ExponentialLr ParamString = "exponential"
+	CosineLr      ParamString = "cosine"
+)
+
+// Predefined values for hyper-parameter Solver.
+const (
+	Cholesky ParamString = "cholesky"
+	CG       ParamString = "cg"
+)
+
 // Params for an algorithm. Given by:
 //  map[string]interface{}{
 //     "<parameter name 1>": <parameter value 1>,
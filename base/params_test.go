@@ -1,6 +1,8 @@
 package base
 
 import (
+	"bytes"
+	"encoding/gob"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -117,3 +119,12 @@ func TestParams_GetString(t *testing.T) {
 	p[Similarity] = 1
 	assert.Equal(t, Cosine, p.GetString(Similarity, Cosine))
 }
+
+func TestParams_Gob(t *testing.T) {
+	params := Params{Target: BPR, NEpochs: 1}
+	buffer := new(bytes.Buffer)
+	assert.Nil(t, gob.NewEncoder(buffer).Encode(params))
+	var decoded Params
+	assert.Nil(t, gob.NewDecoder(buffer).Decode(&decoded))
+	assert.Equal(t, params, decoded)
+}
@@ -1,15 +1,73 @@
 package base
 
-import "math/rand"
+import (
+	"math/bits"
+	"math/rand"
+)
 
-// RandomGenerator is the random generator for gorse.
+// RandomGenerator is the random generator for gorse. Its state could be saved
+// and restored.
 type RandomGenerator struct {
 	*rand.Rand
+	source *xoshiroSource
 }
 
 // NewRandomGenerator creates a RandomGenerator.
 func NewRandomGenerator(seed int64) RandomGenerator {
-	return RandomGenerator{rand.New(rand.NewSource(int64(seed)))}
+	source := &xoshiroSource{}
+	source.Seed(seed)
+	return RandomGenerator{rand.New(source), source}
+}
+
+// NewRandomGeneratorFromState creates a RandomGenerator from a saved state.
+func NewRandomGeneratorFromState(state GeneratorState) RandomGenerator {
+	source := &xoshiroSource{state: state.Words}
+	return RandomGenerator{rand.New(source), source}
+}
+
+// GeneratorState is the state of a RandomGenerator.
+type GeneratorState struct {
+	Words [4]uint64 // The state of xoshiro256**
+}
+
+// State returns the current state of the generator.
+func (rng RandomGenerator) State() GeneratorState {
+	return GeneratorState{Words: rng.source.state}
+}
+
+// xoshiroSource is a rand.Source64 implementing xoshiro256** by Blackman and
+// Vigna, whose state is four words.
+type xoshiroSource struct {
+	state [4]uint64
+}
+
+// Seed initializes the state by SplitMix64 from the seed.
+func (source *xoshiroSource) Seed(seed int64) {
+	x := uint64(seed)
+	for i := range source.state {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		source.state[i] = z ^ (z >> 31)
+	}
+}
+
+func (source *xoshiroSource) Uint64() uint64 {
+	s := &source.state
+	result := bits.RotateLeft64(s[1]*5, 7) * 9
+	t := s[1] << 17
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+	s[2] ^= t
+	s[3] = bits.RotateLeft64(s[3], 45)
+	return result
+}
+
+func (source *xoshiroSource) Int63() int64 {
+	return int64(source.Uint64() >> 1)
 }
 
 // MakeUniformVectorInt makes a vector filled with uniform random integers.
@@ -30,3 +30,34 @@ func TestRandomGenerator_MakeUniformMatrix(t *testing.T) {
 	assert.False(t, floats.Min(vec) < 1)
 	assert.False(t, floats.Max(vec) > 2)
 }
+
+func TestNewRandomGeneratorFromState(t *testing.T) {
+	rng := NewRandomGenerator(1)
+	rng.MakeNormalVector(100, 0, 1)
+	rng.Perm(100)
+	state := rng.State()
+	// Restored generator continues the sequence
+	restored := NewRandomGeneratorFromState(state)
+	assert.Equal(t, state, restored.State())
+	assert.Equal(t, rng.Perm(100), restored.Perm(100))
+	assert.Equal(t, rng.MakeNormalVector(100, 0, 1), restored.MakeNormalVector(100, 0, 1))
+	assert.Equal(t, rng.Uint64(), restored.Uint64())
+}
+
+func TestNewRandomGenerator(t *testing.T) {
+	// Same seeds give same sequences
+	rng, same, other := NewRandomGenerator(1), NewRandomGenerator(1), NewRandomGenerator(2)
+	assert.Equal(t, rng.Perm(100), same.Perm(100))
+	assert.NotEqual(t, rng.Perm(100), other.Perm(100))
+	// Reseed
+	rng.Seed(2)
+	assert.Equal(t, NewRandomGenerator(2).Perm(100), rng.Perm(100))
+	// Reference outputs of xoshiro256**
+	ref := NewRandomGeneratorFromState(GeneratorState{Words: [4]uint64{1, 2, 3, 4}})
+	for _, expected := range []uint64{11520, 0, 1509978240, 1215971899390074240} {
+		assert.Equal(t, expected, ref.Uint64())
+	}
+	// Uniform floats
+	vec := rng.MakeUniformVector(10000, 0, 1)
+	assert.InDelta(t, 0.5, stat.Mean(vec, nil), 0.01)
+}
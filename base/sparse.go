@@ -4,6 +4,7 @@ import (
 	"container/heap"
 	"gonum.org/v1/gonum/stat"
 	"sort"
+	"strconv"
 )
 
 // SparseIdSet manages the map between dense IDs and sparse IDs.
@@ -36,6 +37,19 @@ func (set *SparseIdSet) Add(sparseId int) {
 	}
 }
 
+// Clone returns a copy of the ID set, which could be modified independently.
+func (set *SparseIdSet) Clone() SparseIdSet {
+	ret := SparseIdSet{
+		DenseIds:  make(map[int]int, len(set.DenseIds)),
+		SparseIds: make([]int, len(set.SparseIds)),
+	}
+	for sparseId, denseId := range set.DenseIds {
+		ret.DenseIds[sparseId] = denseId
+	}
+	copy(ret.SparseIds, set.SparseIds)
+	return ret
+}
+
 // ToDenseId converts a sparse ID to a dense ID.
 func (set *SparseIdSet) ToDenseId(sparseId int) int {
 	if denseId, exist := set.DenseIds[sparseId]; exist {
@@ -49,6 +63,69 @@ func (set *SparseIdSet) ToSparseId(denseId int) int {
 	return set.SparseIds[denseId]
 }
 
+// StringIdSet manages the map between raw string IDs and sparse IDs. A nil
+// StringIdSet means that raw IDs are decimal representations of sparse IDs.
+type StringIdSet struct {
+	SparseIds map[string]int
+	StringIds []string
+}
+
+// NewStringIdSet creates a StringIdSet.
+func NewStringIdSet() *StringIdSet {
+	return &StringIdSet{
+		SparseIds: make(map[string]int),
+		StringIds: make([]string, 0),
+	}
+}
+
+// Len returns the number of IDs.
+func (set *StringIdSet) Len() int {
+	if set == nil {
+		return 0
+	}
+	return len(set.StringIds)
+}
+
+// Add adds a new raw ID to the ID set and returns its sparse ID.
+func (set *StringIdSet) Add(stringId string) int {
+	if sparseId, exist := set.SparseIds[stringId]; exist {
+		return sparseId
+	}
+	sparseId := len(set.StringIds)
+	set.SparseIds[stringId] = sparseId
+	set.StringIds = append(set.StringIds, stringId)
+	return sparseId
+}
+
+// ToSparseId converts a raw ID to a sparse ID.
+func (set *StringIdSet) ToSparseId(stringId string) int {
+	if set == nil {
+		if sparseId, err := strconv.Atoi(stringId); err == nil {
+			return sparseId
+		}
+		return NotId
+	}
+	if sparseId, exist := set.SparseIds[stringId]; exist {
+		return sparseId
+	}
+	return NotId
+}
+
+// ToStringId converts a sparse ID to a raw ID. An empty string is returned if
+// the sparse ID doesn't exist.
+func (set *StringIdSet) ToStringId(sparseId int) string {
+	if sparseId == NotId {
+		return ""
+	}
+	if set == nil {
+		return strconv.Itoa(sparseId)
+	}
+	if sparseId < 0 || sparseId >= len(set.StringIds) {
+		return ""
+	}
+	return set.StringIds[sparseId]
+}
+
 // SparseVector handles the sparse vector.
 type SparseVector struct {
 	Indices []int
@@ -96,6 +173,15 @@ func (vec *SparseVector) Add(index int, value float64) {
 	vec.Sorted = false
 }
 
+// Clone returns a copy of the vector, which could be modified independently.
+func (vec *SparseVector) Clone() SparseVector {
+	return SparseVector{
+		Indices: append(make([]int, 0, len(vec.Indices)), vec.Indices...),
+		Values:  append(make([]float64, 0, len(vec.Values)), vec.Values...),
+		Sorted:  vec.Sorted,
+	}
+}
+
 // Len returns the number of items.
 func (vec *SparseVector) Len() int {
 	return len(vec.Values)
@@ -27,6 +27,47 @@ func TestSparseIdSet(t *testing.T) {
 	assert.Equal(t, 8, set.ToSparseId(3))
 }
 
+func TestSparseIdSet_Clone(t *testing.T) {
+	set := MakeSparseIdSet()
+	set.Add(1)
+	set.Add(2)
+	clone := set.Clone()
+	clone.Add(4)
+	assert.Equal(t, 2, set.Len())
+	assert.Equal(t, NotId, set.ToDenseId(4))
+	assert.Equal(t, 3, clone.Len())
+	assert.Equal(t, 1, clone.ToDenseId(2))
+	assert.Equal(t, 2, clone.ToDenseId(4))
+}
+
+func TestStringIdSet(t *testing.T) {
+	// Create a ID set
+	set := NewStringIdSet()
+	assert.Equal(t, 0, set.Len())
+	// Add IDs
+	assert.Equal(t, 0, set.Add("a"))
+	assert.Equal(t, 1, set.Add("b"))
+	assert.Equal(t, 0, set.Add("a"))
+	assert.Equal(t, 2, set.Add("8"))
+	assert.Equal(t, 3, set.Len())
+	assert.Equal(t, 0, set.ToSparseId("a"))
+	assert.Equal(t, 1, set.ToSparseId("b"))
+	assert.Equal(t, 2, set.ToSparseId("8"))
+	assert.Equal(t, NotId, set.ToSparseId("c"))
+	assert.Equal(t, "a", set.ToStringId(0))
+	assert.Equal(t, "b", set.ToStringId(1))
+	assert.Equal(t, "8", set.ToStringId(2))
+	assert.Equal(t, "", set.ToStringId(3))
+	assert.Equal(t, "", set.ToStringId(NotId))
+	// Nil ID set
+	var nilSet *StringIdSet
+	assert.Equal(t, 0, nilSet.Len())
+	assert.Equal(t, 8, nilSet.ToSparseId("8"))
+	assert.Equal(t, NotId, nilSet.ToSparseId("a"))
+	assert.Equal(t, "8", nilSet.ToStringId(8))
+	assert.Equal(t, "", nilSet.ToStringId(NotId))
+}
+
 func TestSparseVector(t *testing.T) {
 	vec := NewSparseVector()
 	// Add new items
@@ -42,6 +83,19 @@ func TestSparseVector(t *testing.T) {
 	assert.Equal(t, []float64{0, 1, 2, 3}, vec.Values)
 }
 
+func TestSparseVector_Clone(t *testing.T) {
+	vec := NewSparseVector()
+	vec.Add(2, 1)
+	vec.Add(0, 0)
+	clone := vec.Clone()
+	clone.Add(8, 3)
+	clone.Values[0] = 5
+	assert.Equal(t, []int{2, 0}, vec.Indices)
+	assert.Equal(t, []float64{1, 0}, vec.Values)
+	assert.Equal(t, []int{2, 0, 8}, clone.Indices)
+	assert.Equal(t, []float64{5, 0, 3}, clone.Values)
+}
+
 func TestSparseVector_ForIntersection(t *testing.T) {
 	a := NewSparseVector()
 	a.Add(2, 1)
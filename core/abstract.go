@@ -1,6 +1,9 @@
 package core
 
-import "github.com/zhenghaoz/gorse/base"
+import (
+	"github.com/zhenghaoz/gorse/base"
+	"gonum.org/v1/gonum/mat"
+)
 
 /* Model */
 
@@ -17,6 +20,64 @@ type Model interface {
 	Fit(trainSet DataSet, setters ...base.FitOption)
 }
 
+// Recommender is the interface for models recommending items to users. All
+// models in package model implement it.
+type Recommender interface {
+	// Recommend returns top-n items and their scores in descending order for a
+	// user (userId). Items are picked from all items in the training set unless
+	// candidates are given by WithCandidates.
+	Recommend(userId int, n int, options ...RecommendOption) ([]int, []float64)
+}
+
+// BatchPredictor is the interface for models predicting ratings in batches.
+// Factor models implement it by matrix-vector products.
+type BatchPredictor interface {
+	// PredictItems predicts ratings given by a user (userId) to a list of items.
+	PredictItems(userId int, itemIds []int) []float64
+	// PredictAll predicts ratings given by a list of users to all items in the
+	// training set. The rating of userIds[i] to itemIds[j] is scores.At(i, j).
+	PredictAll(userIds []int) (itemIds []int, scores *mat.Dense)
+}
+
+// SimilarFinder is the interface for models finding similar items and users.
+type SimilarFinder interface {
+	// SimilarItems returns top-n items most similar to an item (itemId) and
+	// their similarities in descending order.
+	SimilarItems(itemId int, n int) ([]int, []float64)
+	// SimilarUsers returns top-n users most similar to a user (userId) and
+	// their similarities in descending order.
+	SimilarUsers(userId int, n int) ([]int, []float64)
+}
+
+// PartialFitter is the interface for models updated incrementally with new
+// ratings.
+type PartialFitter interface {
+	// PartialFit updates a model with new ratings by nEpochs passes. Unseen
+	// users and items are added to the model.
+	PartialFit(table Table, nEpochs int, options ...base.FitOption)
+}
+
+// FoldInner is the interface for models folding in users without retraining.
+type FoldInner interface {
+	// FoldIn solves the latent factor of a user (userId) from ratings given to
+	// items (itemIds) while other parameters are fixed. A new user is added to
+	// the model and could be served immediately.
+	FoldIn(userId int, itemIds []int, ratings []float64)
+}
+
+// RawIdMapper is the interface for converting between raw string IDs and IDs.
+// DataSet and models in package model implement it.
+type RawIdMapper interface {
+	// UserId converts a raw user ID to the user ID.
+	UserId(rawUserId string) int
+	// ItemId converts a raw item ID to the item ID.
+	ItemId(rawItemId string) int
+	// RawUserId converts a user ID to the raw user ID.
+	RawUserId(userId int) string
+	// RawItemId converts a item ID to the raw item ID.
+	RawItemId(itemId int) string
+}
+
 /* Table */
 
 type Table interface {
@@ -24,6 +85,11 @@ type Table interface {
 	Len() int
 	// Get the i-th entry in dataset.
 	Get(i int) (int, int, float64)
+	// HasTimestamp returns true if timestamps are available.
+	HasTimestamp() bool
+	// GetTimestamp gets the timestamp of the i-th entry. Zero is returned if
+	// timestamps are not available.
+	GetTimestamp(i int) int64
 	// Mean of ratings.
 	Mean() float64
 	// StdDev of ratings.
@@ -6,60 +6,66 @@ import "os/user"
 
 // Built-in data set
 type _BuiltInDataSet struct {
-	url    string
-	path   string
-	sep    string
-	header bool
-	loader func(string, string, bool) DataSet
+	url        string
+	path       string
+	sep        string
+	header     bool
+	timestamps bool
+	loader     func(string, string, bool, ...LoadOption) (DataSet, error)
 }
 
 var builtInDataSets = map[string]_BuiltInDataSet{
 	"ml-100k": {
-		url:    "https://cdn.sine-x.com/datasets/movielens/ml-100k.zip",
-		path:   "ml-100k/u.data",
-		sep:    "\t",
-		header: false,
-		loader: LoadDataFromCSV,
+		url:        "https://cdn.sine-x.com/datasets/movielens/ml-100k.zip",
+		path:       "ml-100k/u.data",
+		sep:        "\t",
+		header:     false,
+		timestamps: true,
+		loader:     ReadDataFromCSV,
 	},
 	"ml-1m": {
-		url:    "https://cdn.sine-x.com/datasets/movielens/ml-1m.zip",
-		path:   "ml-1m/ratings.dat",
-		sep:    "::",
-		header: false,
-		loader: LoadDataFromCSV,
+		url:        "https://cdn.sine-x.com/datasets/movielens/ml-1m.zip",
+		path:       "ml-1m/ratings.dat",
+		sep:        "::",
+		header:     false,
+		timestamps: true,
+		loader:     ReadDataFromCSV,
 	},
 	"ml-10m": {
-		url:    "https://cdn.sine-x.com/datasets/movielens/ml-10m.zip",
-		path:   "ml-10M100K/ratings.dat",
-		sep:    "::",
-		header: false,
-		loader: LoadDataFromCSV,
+		url:        "https://cdn.sine-x.com/datasets/movielens/ml-10m.zip",
+		path:       "ml-10M100K/ratings.dat",
+		sep:        "::",
+		header:     false,
+		timestamps: true,
+		loader:     ReadDataFromCSV,
 	},
 	"ml-20m": {
-		url:    "https://cdn.sine-x.com/datasets/movielens/ml-20m.zip",
-		path:   "ml-20m/ratings.csv",
-		sep:    ",",
-		header: false,
-		loader: LoadDataFromCSV,
+		url:        "https://cdn.sine-x.com/datasets/movielens/ml-20m.zip",
+		path:       "ml-20m/ratings.csv",
+		sep:        ",",
+		header:     true,
+		timestamps: true,
+		loader:     ReadDataFromCSV,
 	},
 	"netflix": {
-		url:    "https://cdn.sine-x.com/datasets/netflix/netflix-prize-data.zip",
-		path:   "netflix/training_set.txt",
-		loader: LoadDataFromNetflixStyle,
+		url:        "https://cdn.sine-x.com/datasets/netflix/netflix-prize-data.zip",
+		path:       "netflix/training_set.txt",
+		timestamps: true,
+		loader:     ReadDataFromNetflixStyle,
 	},
 	"filmtrust": {
 		url:    "https://cdn.sine-x.com/datasets/filmtrust/filmtrust.zip",
 		path:   "filmtrust/ratings.txt",
 		sep:    " ",
 		header: false,
-		loader: LoadDataFromCSV,
+		loader: ReadDataFromCSV,
 	},
 	"epinions": {
 		url:    "https://cdn.sine-x.com/datasets/epinions/epinions.zip",
 		path:   "epinions/ratings_data.txt",
 		sep:    " ",
 		header: true,
-		loader: LoadDataFromCSV,
+		loader: ReadDataFromCSV,
 	},
 }
 
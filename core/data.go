@@ -3,6 +3,7 @@ package core
 import (
 	"archive/zip"
 	"bufio"
+	"database/sql"
 	"fmt"
 	"github.com/zhenghaoz/gorse/base"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Train data set.
@@ -22,8 +24,12 @@ type DataSet struct {
 	DenseItemIds     []int
 	DenseUserRatings []base.SparseVector
 	DenseItemRatings []base.SparseVector
-	UserIdSet        base.SparseIdSet // Users' ID set
-	ItemIdSet        base.SparseIdSet // Items' ID set
+	UserIdSet        base.SparseIdSet  // Users' ID set
+	ItemIdSet        base.SparseIdSet  // Items' ID set
+	UserRawIds       *base.StringIdSet // Users' raw ID set, nil if raw IDs are integers
+	ItemRawIds       *base.StringIdSet // Items' raw ID set, nil if raw IDs are integers
+	ColdUserIds      base.SparseIdSet  // Cold users in a test set, recorded by cold-start splitters
+	ColdItemIds      base.SparseIdSet  // Cold items in a test set, recorded by cold-start splitters
 }
 
 // NewDataSet creates a train set from a raw data set.
@@ -68,31 +74,373 @@ func (trainSet *DataSet) ItemCount() int {
 	return trainSet.ItemIdSet.Len()
 }
 
+// RawUserId converts a user ID to the raw user ID. An empty string is returned if the ID doesn't exist.
+func (trainSet *DataSet) RawUserId(userId int) string {
+	return trainSet.UserRawIds.ToStringId(userId)
+}
+
+// RawItemId converts a item ID to the raw item ID. An empty string is returned if the ID doesn't exist.
+func (trainSet *DataSet) RawItemId(itemId int) string {
+	return trainSet.ItemRawIds.ToStringId(itemId)
+}
+
+// UserId converts a raw user ID to the user ID. NotId is returned if the raw ID doesn't exist.
+func (trainSet *DataSet) UserId(rawUserId string) int {
+	return trainSet.UserRawIds.ToSparseId(rawUserId)
+}
+
+// ItemId converts a raw item ID to the item ID. NotId is returned if the raw ID doesn't exist.
+func (trainSet *DataSet) ItemId(rawItemId string) int {
+	return trainSet.ItemRawIds.ToSparseId(rawItemId)
+}
+
+// HasCold returns true if cold users or cold items are recorded.
+func (trainSet *DataSet) HasCold() bool {
+	return trainSet.ColdUserIds.Len() > 0 || trainSet.ColdItemIds.Len() > 0
+}
+
+// IsCold returns true if the user or the item is cold.
+func (trainSet *DataSet) IsCold(userId, itemId int) bool {
+	return trainSet.ColdUserIds.ToDenseId(userId) != base.NotId ||
+		trainSet.ColdItemIds.ToDenseId(itemId) != base.NotId
+}
+
+// SplitCold splits a test set to ratings of warm users and items, and ratings
+// of cold users or items.
+func (trainSet *DataSet) SplitCold() (warm, cold DataSet) {
+	warmIndex, coldIndex := make([]int, 0), make([]int, 0)
+	for i := 0; i < trainSet.Len(); i++ {
+		userId, itemId, _ := trainSet.Get(i)
+		if trainSet.IsCold(userId, itemId) {
+			coldIndex = append(coldIndex, i)
+		} else {
+			warmIndex = append(warmIndex, i)
+		}
+	}
+	warm = NewDataSet(trainSet.SubSet(warmIndex))
+	cold = NewDataSet(trainSet.SubSet(coldIndex))
+	for _, set := range []*DataSet{&warm, &cold} {
+		set.UserRawIds, set.ItemRawIds = trainSet.UserRawIds, trainSet.ItemRawIds
+	}
+	cold.ColdUserIds, cold.ColdItemIds = trainSet.ColdUserIds, trainSet.ColdItemIds
+	return
+}
+
 /* Loader */
 
+// LoadOptions contains options used in data loaders.
+type LoadOptions struct {
+	userRawIds *base.StringIdSet
+	itemRawIds *base.StringIdSet
+	policy     ParsePolicy
+	timestamps bool
+	report     *LoadReport
+}
+
+// NewLoadOptions creates a LoadOptions from LoadOption.
+func NewLoadOptions(option []LoadOption) *LoadOptions {
+	options := new(LoadOptions)
+	for _, opt := range option {
+		opt(options)
+	}
+	return options
+}
+
+// LoadOption changes options of data loaders.
+type LoadOption func(*LoadOptions)
+
+// WithStringIds treats user IDs and item IDs as raw strings, such as UUIDs or
+// SKUs. Raw IDs are mapped to integer IDs in the order of occurrence, and the
+// map is kept in DataSet.UserRawIds and DataSet.ItemRawIds.
+func WithStringIds() LoadOption {
+	return WithRawIds(base.NewStringIdSet(), base.NewStringIdSet())
+}
+
+// WithRawIds treats user IDs and item IDs as raw strings and maps them through
+// given ID sets. New raw IDs are added to the sets. It's useful to share the map
+// between data sets loaded separately, such as a train set and a test set.
+func WithRawIds(userRawIds, itemRawIds *base.StringIdSet) LoadOption {
+	return func(options *LoadOptions) {
+		options.userRawIds = userRawIds
+		options.itemRawIds = itemRawIds
+	}
+}
+
+// WithTimestamps loads timestamps as well. A timestamp could be a Unix timestamp
+// in seconds, a date (2006-01-02) or a RFC 3339 time. Lines without valid
+// timestamps are handled by the ParsePolicy.
+func WithTimestamps() LoadOption {
+	return func(options *LoadOptions) {
+		options.timestamps = true
+	}
+}
+
+// WithParsePolicy sets the policy for malformed lines. Default is FailOnError
+// for Read* loaders and SkipOnError for Load* loaders, which exit on errors.
+func WithParsePolicy(policy ParsePolicy) LoadOption {
+	return func(options *LoadOptions) {
+		options.policy = policy
+	}
+}
+
+// WithLoadReport fills the report with the number of accepted lines and
+// rejected lines after loading.
+func WithLoadReport(report *LoadReport) LoadOption {
+	return func(options *LoadOptions) {
+		options.report = report
+	}
+}
+
+// ParsePolicy decides how data loaders handle malformed lines.
+type ParsePolicy int
+
+const (
+	// FailOnError stops loading and returns the error of the first malformed line.
+	FailOnError ParsePolicy = iota
+	// SkipOnError skips malformed lines. Rejected lines are counted in LoadReport.
+	SkipOnError
+	// CollectErrors skips malformed lines and collects their errors. Collected
+	// errors are returned as ParseErrors along with the data set.
+	CollectErrors
+)
+
+// ParseError records a malformed line.
+type ParseError struct {
+	Line int    // The line number starting from 1
+	Text string // The content of the line
+	Err  error  // The reason
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ParseErrors is a list of errors of malformed lines.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+}
+
+// LoadReport contains statistics of loading.
+type LoadReport struct {
+	Accepted int           // The number of accepted lines
+	Rejected int           // The number of rejected lines
+	Errors   []*ParseError // Errors of rejected lines, only collected by CollectErrors
+}
+
+// dataBuilder builds a data set line by line following the loader options.
+type dataBuilder struct {
+	*LoadOptions
+	users   []int
+	items   []int
+	ratings []float64
+	times   []int64
+	summary LoadReport
+}
+
+func newDataBuilder(option []LoadOption) *dataBuilder {
+	builder := &dataBuilder{
+		LoadOptions: NewLoadOptions(option),
+		users:       make([]int, 0),
+		items:       make([]int, 0),
+		ratings:     make([]float64, 0),
+	}
+	if builder.timestamps {
+		builder.times = make([]int64, 0)
+	}
+	return builder
+}
+
+// fieldCount returns the number of required fields in a record.
+func (builder *dataBuilder) fieldCount() int {
+	if builder.timestamps {
+		return 4
+	}
+	return 3
+}
+
+// parseId parses a raw ID to a integer ID.
+func parseId(rawIds *base.StringIdSet, field string) (int, error) {
+	if rawIds != nil {
+		return rawIds.Add(field), nil
+	}
+	return strconv.Atoi(field)
+}
+
+// field returns the i-th field or an empty string if it doesn't exist.
+func field(fields []string, i int) string {
+	if i < len(fields) {
+		return fields[i]
+	}
+	return ""
+}
+
+// parseTimestamp parses a Unix timestamp, a date or a RFC 3339 time to a Unix timestamp.
+func parseTimestamp(field string) (int64, error) {
+	if timestamp, err := strconv.ParseInt(field, 10, 64); err == nil {
+		return timestamp, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, field); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid timestamp %q", field)
+}
+
+// add parses and adds a record. Raw IDs are added to the raw ID sets only if
+// the record is accepted. The timestamp field is ignored unless timestamps
+// are required.
+func (builder *dataBuilder) add(lineNumber int, line string, userField, itemField, ratingField, timestampField string) error {
+	rating, err := strconv.ParseFloat(strings.TrimSpace(ratingField), 32)
+	if err != nil {
+		return builder.reject(lineNumber, line, err)
+	}
+	var timestamp int64
+	if builder.timestamps {
+		if timestamp, err = parseTimestamp(strings.TrimSpace(timestampField)); err != nil {
+			return builder.reject(lineNumber, line, err)
+		}
+	}
+	userField, itemField = strings.TrimSpace(userField), strings.TrimSpace(itemField)
+	if builder.userRawIds == nil {
+		if _, err = strconv.Atoi(userField); err != nil {
+			return builder.reject(lineNumber, line, err)
+		}
+	}
+	if builder.itemRawIds == nil {
+		if _, err = strconv.Atoi(itemField); err != nil {
+			return builder.reject(lineNumber, line, err)
+		}
+	}
+	userId, _ := parseId(builder.userRawIds, userField)
+	itemId, _ := parseId(builder.itemRawIds, itemField)
+	builder.users = append(builder.users, userId)
+	builder.items = append(builder.items, itemId)
+	builder.ratings = append(builder.ratings, rating)
+	if builder.timestamps {
+		builder.times = append(builder.times, timestamp)
+	}
+	builder.summary.Accepted++
+	return nil
+}
+
+// addNullable adds a record of nullable columns. A record with NULL columns
+// is rejected.
+func (builder *dataBuilder) addNullable(lineNumber int, columns []sql.NullString) error {
+	fields := make([]string, 4)
+	for i, column := range columns {
+		if !column.Valid {
+			return builder.reject(lineNumber, "", fmt.Errorf("NULL in column %d", i+1))
+		}
+		fields[i] = column.String
+	}
+	return builder.add(lineNumber, "", fields[0], fields[1], fields[2], fields[3])
+}
+
+// reject records a malformed line. An error is returned if loading should stop.
+func (builder *dataBuilder) reject(lineNumber int, line string, err error) error {
+	parseError := &ParseError{Line: lineNumber, Text: line, Err: err}
+	builder.summary.Rejected++
+	switch builder.policy {
+	case SkipOnError:
+		return nil
+	case CollectErrors:
+		builder.summary.Errors = append(builder.summary.Errors, parseError)
+		return nil
+	default:
+		return parseError
+	}
+}
+
+// build creates the data set. Collected errors are returned as ParseErrors.
+func (builder *dataBuilder) build() (DataSet, error) {
+	if builder.report != nil {
+		*builder.report = builder.summary
+	}
+	set := NewDataSet(NewTimedDataTable(builder.users, builder.items, builder.ratings, builder.times))
+	set.UserRawIds = builder.userRawIds
+	set.ItemRawIds = builder.itemRawIds
+	if len(builder.summary.Errors) > 0 {
+		return set, ParseErrors(builder.summary.Errors)
+	}
+	return set, nil
+}
+
+// fail returns the error and fills the report.
+func (builder *dataBuilder) fail(err error) (DataSet, error) {
+	if builder.report != nil {
+		*builder.report = builder.summary
+	}
+	return DataSet{}, err
+}
+
+// skipByDefault sets SkipOnError as the default ParsePolicy of Load* loaders,
+// which could be overridden by options.
+func skipByDefault(option []LoadOption) []LoadOption {
+	return append([]LoadOption{WithParsePolicy(SkipOnError)}, option...)
+}
+
+// mustLoad returns the data set of a Read* loader. Collected ParseErrors are
+// logged along with the data set, and the program exits on other errors.
+func mustLoad(set DataSet, err error) DataSet {
+	if parseErrors, ok := err.(ParseErrors); ok {
+		log.Printf("Skip %d malformed lines: %v", len(parseErrors), parseErrors)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	return set
+}
+
 // LoadDataFromBuiltIn loads a built-in data set. Now support:
 //   ml-100k	- MovieLens 100K
 //   ml-1m		- MovieLens 1M
 //   ml-10m		- MovieLens 10M
 //   ml-20m		- MovieLens 20M
 //   netflix    - Netflix Prize
-func LoadDataFromBuiltIn(dataSetName string) DataSet {
+// It's same as ReadDataFromBuiltIn except that malformed lines are skipped by
+// default, collected ParseErrors are logged, and the program exits on other
+// errors.
+func LoadDataFromBuiltIn(dataSetName string, option ...LoadOption) DataSet {
+	return mustLoad(ReadDataFromBuiltIn(dataSetName, skipByDefault(option)...))
+}
+
+// ReadDataFromBuiltIn loads a built-in data set. The data set is downloaded
+// if it doesn't exist. Timestamps are loaded for MovieLens and Netflix Prize.
+func ReadDataFromBuiltIn(dataSetName string, option ...LoadOption) (DataSet, error) {
 	// Extract data set information
 	dataSet, exist := builtInDataSets[dataSetName]
 	if !exist {
-		log.Fatal("no such data set ", dataSetName)
+		return DataSet{}, fmt.Errorf("no such data set %s", dataSetName)
 	}
 	dataFileName := filepath.Join(dataSetDir, dataSet.path)
 	if _, err := os.Stat(dataFileName); os.IsNotExist(err) {
-		zipFileName, _ := downloadFromUrl(dataSet.url, downloadDir)
+		zipFileName, err := downloadFromUrl(dataSet.url, downloadDir)
+		if err != nil {
+			return DataSet{}, err
+		}
 		if _, err := unzip(zipFileName, dataSetDir); err != nil {
-			panic(err)
+			return DataSet{}, err
 		}
 	}
-	return dataSet.loader(dataFileName, dataSet.sep, dataSet.header)
+	if dataSet.timestamps {
+		option = append([]LoadOption{WithTimestamps()}, option...)
+	}
+	return dataSet.loader(dataFileName, dataSet.sep, dataSet.header, option...)
 }
 
-// LoadDataFromCSV loads data from a CSV file. The CSV file should be:
+// LoadDataFromCSV loads data from a CSV file. It's same as ReadDataFromCSV
+// except that malformed lines are skipped by default, collected ParseErrors
+// are logged, and the program exits on other errors.
+func LoadDataFromCSV(fileName string, sep string, hasHeader bool, option ...LoadOption) DataSet {
+	return mustLoad(ReadDataFromCSV(fileName, sep, hasHeader, skipByDefault(option)...))
+}
+
+// ReadDataFromCSV loads data from a CSV file. The CSV file should be:
 //
 //   [optional header]
 // 	 <userId 1> <sep> <itemId 1> <sep> <rating 1> <sep> <extras>
@@ -106,41 +454,55 @@ func LoadDataFromBuiltIn(dataSetName string) DataSet {
 //  186\t302\t3\t891717742
 //  22\t377\t1\t878887116
 //
-func LoadDataFromCSV(fileName string, sep string, hasHeader bool) DataSet {
-	users := make([]int, 0)
-	items := make([]int, 0)
-	ratings := make([]float64, 0)
+// IDs are parsed as integers unless WithStringIds or WithRawIds is given. The
+// 4th field is parsed as the timestamp if WithTimestamps is given. Empty lines
+// are ignored and malformed lines are handled by the ParsePolicy.
+func ReadDataFromCSV(fileName string, sep string, hasHeader bool, option ...LoadOption) (DataSet, error) {
+	builder := newDataBuilder(option)
 	// Open file
 	file, err := os.Open(fileName)
 	if err != nil {
-		log.Fatal(err)
+		return builder.fail(err)
 	}
 	defer file.Close()
 	// Read CSV file
 	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
 		line := scanner.Text()
 		// Ignore header
 		if hasHeader {
 			hasHeader = false
 			continue
 		}
-		fields := strings.Split(line, sep)
 		// Ignore empty line
-		if len(fields) < 2 {
+		if len(strings.TrimSpace(line)) == 0 {
 			continue
 		}
-		user, _ := strconv.Atoi(fields[0])
-		item, _ := strconv.Atoi(fields[1])
-		rating, _ := strconv.ParseFloat(fields[2], 32)
-		users = append(users, user)
-		items = append(items, item)
-		ratings = append(ratings, rating)
+		fields := strings.Split(line, sep)
+		if len(fields) < builder.fieldCount() {
+			err = builder.reject(lineNumber, line,
+				fmt.Errorf("expect at least %d fields but get %d", builder.fieldCount(), len(fields)))
+		} else {
+			err = builder.add(lineNumber, line, fields[0], fields[1], fields[2], field(fields, 3))
+		}
+		if err != nil {
+			return builder.fail(err)
+		}
 	}
-	return NewDataSet(NewDataTable(users, items, ratings))
+	if err = scanner.Err(); err != nil {
+		return builder.fail(err)
+	}
+	return builder.build()
+}
+
+// LoadDataFromNetflixStyle load data from a Netflix-style file. It's same as
+// ReadDataFromNetflixStyle except that malformed lines are skipped by default,
+// collected ParseErrors are logged, and the program exits on other errors.
+func LoadDataFromNetflixStyle(fileName string, sep string, hasHeader bool, option ...LoadOption) DataSet {
+	return mustLoad(ReadDataFromNetflixStyle(fileName, sep, hasHeader, skipByDefault(option)...))
 }
 
-// LoadDataFromNetflixStyle load data from a Netflix-style file. The CSV file should be:
+// ReadDataFromNetflixStyle load data from a Netflix-style file. The CSV file should be:
 //
 //   <itemId 1>:
 //   <userId 1>, <rating 1>, <date>
@@ -148,42 +510,116 @@ func LoadDataFromCSV(fileName string, sep string, hasHeader bool) DataSet {
 //   <userId 3>, <rating 3>, <date>
 //   ...
 //
-func LoadDataFromNetflixStyle(fileName string, _ string, _ bool) DataSet {
-	users := make([]int, 0)
-	items := make([]int, 0)
-	ratings := make([]float64, 0)
+// IDs are parsed as integers unless WithStringIds or WithRawIds is given. The
+// date is parsed as the timestamp if WithTimestamps is given. Empty lines are
+// ignored and malformed lines are handled by the ParsePolicy.
+func ReadDataFromNetflixStyle(fileName string, _ string, _ bool, option ...LoadOption) (DataSet, error) {
+	builder := newDataBuilder(option)
 	// Open file
 	file, err := os.Open(fileName)
 	if err != nil {
-		log.Fatal(err)
+		return builder.fail(err)
 	}
 	defer file.Close()
 	// Read file
 	scanner := bufio.NewScanner(file)
-	itemId := -1
-	for scanner.Scan() {
-		line := scanner.Text()
+	itemField := ""
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		// Ignore empty line
+		if len(line) == 0 {
+			continue
+		}
 		if line[len(line)-1] == ':' {
 			// <itemId>:
-			if itemId, err = strconv.Atoi(line[0 : len(line)-1]); err != nil {
-				log.Fatal(err)
-			}
+			itemField = line[0 : len(line)-1]
+			continue
+		}
+		// <userId>, <rating>, <date>
+		fields := strings.Split(line, ",")
+		if itemField == "" {
+			err = builder.reject(lineNumber, line, fmt.Errorf("expect <itemId>: before ratings"))
+		} else if len(fields) < builder.fieldCount()-1 {
+			err = builder.reject(lineNumber, line,
+				fmt.Errorf("expect at least %d fields but get %d", builder.fieldCount()-1, len(fields)))
 		} else {
-			// <userId>, <rating>, <date>
-			fields := strings.Split(line, ",")
-			userId, _ := strconv.Atoi(fields[0])
-			rating, _ := strconv.Atoi(fields[1])
-			users = append(users, userId)
-			items = append(items, itemId)
-			ratings = append(ratings, float64(rating))
+			err = builder.add(lineNumber, line, fields[0], itemField, fields[1], field(fields, 2))
+		}
+		if err != nil {
+			return builder.fail(err)
 		}
 	}
-	return NewDataSet(NewDataTable(users, items, ratings))
+	if err = scanner.Err(); err != nil {
+		return builder.fail(err)
+	}
+	return builder.build()
 }
 
-func LoadDataFromSQL() Table {
-	// TODO: Load data from SQL server.
-	return nil
+// LoadDataFromSQL loads data from a SQL database. The query should return
+// rows of (userId, itemId, rating), for example:
+//
+//   SELECT user_id, item_id, rating FROM ratings
+//
+// If WithTimestamps is given, the query should return rows of (userId, itemId,
+// rating, timestamp) instead.
+//
+// Rows are streamed from the database and any error raised by the database
+// is returned. IDs are parsed as integers unless WithStringIds or WithRawIds
+// is given. Malformed rows are handled by the ParsePolicy, where the line
+// number is the row number.
+func LoadDataFromSQL(db *sql.DB, query string, option ...LoadOption) (DataSet, error) {
+	builder := newDataBuilder(option)
+	// Execute query
+	rows, err := db.Query(query)
+	if err != nil {
+		return builder.fail(err)
+	}
+	defer rows.Close()
+	// Read rows
+	for rowNumber := 1; rows.Next(); rowNumber++ {
+		// NULL columns are scanned as well and rejected by the ParsePolicy
+		var columns [4]sql.NullString
+		fields := []interface{}{&columns[0], &columns[1], &columns[2], &columns[3]}
+		if err = rows.Scan(fields[:builder.fieldCount()]...); err != nil {
+			return builder.fail(err)
+		}
+		if err = builder.addNullable(rowNumber, columns[:builder.fieldCount()]); err != nil {
+			return builder.fail(err)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return builder.fail(err)
+	}
+	return builder.build()
+}
+
+// SQLTable describes a table of ratings in a SQL database.
+type SQLTable struct {
+	Name            string // The name of the table
+	UserColumn      string // The column of user IDs
+	ItemColumn      string // The column of item IDs
+	RatingColumn    string // The column of ratings
+	TimestampColumn string // The column of timestamps, optional
+}
+
+// Query returns the query selecting (userId, itemId, rating) from the table.
+// The timestamp is selected as well if the timestamp column is given.
+func (table SQLTable) Query() string {
+	if table.TimestampColumn != "" {
+		return fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s",
+			table.UserColumn, table.ItemColumn, table.RatingColumn, table.TimestampColumn, table.Name)
+	}
+	return fmt.Sprintf("SELECT %s, %s, %s FROM %s",
+		table.UserColumn, table.ItemColumn, table.RatingColumn, table.Name)
+}
+
+// LoadDataFromSQLTable loads data from a table in a SQL database. Timestamps
+// are loaded if the timestamp column is given.
+func LoadDataFromSQLTable(db *sql.DB, table SQLTable, option ...LoadOption) (DataSet, error) {
+	if table.TimestampColumn != "" {
+		option = append([]LoadOption{WithTimestamps()}, option...)
+	}
+	return LoadDataFromSQL(db, table.Query(), option...)
 }
 
 /* Misc */
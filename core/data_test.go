@@ -2,12 +2,17 @@ package core
 
 import (
 	"crypto/md5"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	. "github.com/zhenghaoz/gorse/base"
 	"io"
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
 func md5Sum(fileName string) string {
@@ -54,6 +59,12 @@ func TestUnzip(t *testing.T) {
 func TestLoadDataFromBuiltIn(t *testing.T) {
 	data := LoadDataFromBuiltIn("ml-100k")
 	assert.Equal(t, 100000, data.Len())
+	// Timestamps are loaded
+	assert.True(t, data.HasTimestamp())
+	assert.Equal(t, int64(875002453), data.GetTimestamp(0))
+	// Time-aware splitters work on built-in data sets
+	trains, tests := NewUserLastNSplitter(1)(data, 0)
+	assert.Equal(t, data.Len(), trains[0].Len()+tests[0].Len())
 }
 
 func TestLoadDataFromCSV_Explicit(t *testing.T) {
@@ -70,6 +81,138 @@ func TestLoadDataFromCSV_Explicit(t *testing.T) {
 	}
 }
 
+func TestLoadDataFromCSV_StringIds(t *testing.T) {
+	data := LoadDataFromCSV("../example/data/string_ids.csv", ",", true, WithStringIds())
+	assert.Equal(t, 5, data.Len())
+	assert.Equal(t, 3, data.UserCount())
+	assert.Equal(t, 3, data.ItemCount())
+	rawUsers := []string{"a3f1c2de", "b7e9d410", "a3f1c2de", "c0d2e8f5", "b7e9d410"}
+	rawItems := []string{"SKU-1001", "SKU-1002", "SKU-1003", "SKU-1001", "SKU-1003"}
+	for i := 0; i < data.Len(); i++ {
+		userId, itemId, _ := data.Get(i)
+		assert.Equal(t, rawUsers[i], data.RawUserId(userId))
+		assert.Equal(t, rawItems[i], data.RawItemId(itemId))
+		assert.Equal(t, userId, data.UserId(rawUsers[i]))
+		assert.Equal(t, itemId, data.ItemId(rawItems[i]))
+	}
+	assert.Equal(t, NotId, data.UserId("unknown"))
+	// Split data set
+	train, test := Split(data, 0.4, 0)
+	assert.Equal(t, "SKU-1002", train.RawItemId(data.ItemId("SKU-1002")))
+	assert.Equal(t, "SKU-1002", test.RawItemId(data.ItemId("SKU-1002")))
+	// Share raw IDs between data sets
+	data2 := LoadDataFromCSV("../example/data/string_ids.csv", ",", true,
+		WithRawIds(data.UserRawIds, data.ItemRawIds))
+	for i := 0; i < data.Len(); i++ {
+		userId, itemId, _ := data.Get(i)
+		userId2, itemId2, _ := data2.Get(i)
+		assert.Equal(t, userId, userId2)
+		assert.Equal(t, itemId, itemId2)
+	}
+}
+
+func TestReadDataFromCSV_FailOnError(t *testing.T) {
+	report := LoadReport{}
+	_, err := ReadDataFromCSV("../example/data/malformed.csv", ",", false, WithLoadReport(&report))
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 2, err.(*ParseError).Line)
+	assert.Equal(t, "2,x,3", err.(*ParseError).Text)
+	assert.Equal(t, 1, report.Accepted)
+	assert.Equal(t, 1, report.Rejected)
+	// File not exist
+	_, err = ReadDataFromCSV("../example/data/not_exist.csv", ",", false)
+	assert.Error(t, err)
+}
+
+func TestReadDataFromCSV_SkipOnError(t *testing.T) {
+	report := LoadReport{}
+	data, err := ReadDataFromCSV("../example/data/malformed.csv", ",", false,
+		WithParsePolicy(SkipOnError), WithLoadReport(&report))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, data.Len())
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, 3, report.Rejected)
+	assert.Equal(t, 0, len(report.Errors))
+	userId, itemId, rating := data.Get(1)
+	assert.Equal(t, 5, userId)
+	assert.Equal(t, 5, itemId)
+	assert.Equal(t, 1.0, rating)
+}
+
+func TestReadDataFromCSV_CollectErrors(t *testing.T) {
+	report := LoadReport{}
+	data, err := ReadDataFromCSV("../example/data/malformed.csv", ",", false,
+		WithParsePolicy(CollectErrors), WithLoadReport(&report))
+	assert.Equal(t, 2, data.Len())
+	assert.IsType(t, ParseErrors{}, err)
+	lines := make([]int, 0)
+	for _, e := range err.(ParseErrors) {
+		lines = append(lines, e.Line)
+	}
+	assert.Equal(t, []int{2, 3, 5}, lines)
+	assert.Equal(t, 3, len(report.Errors))
+}
+
+func TestLoadDataFromCSV_ParsePolicy(t *testing.T) {
+	// Skip malformed lines by default
+	report := LoadReport{}
+	data := LoadDataFromCSV("../example/data/malformed.csv", ",", false, WithLoadReport(&report))
+	assert.Equal(t, 2, data.Len())
+	assert.Equal(t, 3, report.Rejected)
+	// Collected errors are logged
+	data = LoadDataFromCSV("../example/data/malformed.csv", ",", false,
+		WithParsePolicy(CollectErrors), WithLoadReport(&report))
+	assert.Equal(t, 2, data.Len())
+	assert.Equal(t, 3, len(report.Errors))
+}
+
+func TestReadDataFromCSV_StringIds(t *testing.T) {
+	// Rejected lines don't add raw IDs
+	data, err := ReadDataFromCSV("../example/data/malformed.csv", ",", false,
+		WithParsePolicy(SkipOnError), WithStringIds())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, data.Len())
+	assert.Equal(t, 3, data.UserRawIds.Len())
+	assert.Equal(t, 3, data.ItemRawIds.Len())
+	assert.Equal(t, NotId, data.UserId("4"))
+}
+
+func TestReadDataFromCSV_Timestamps(t *testing.T) {
+	// Without timestamps
+	data, err := ReadDataFromCSV("../example/data/timestamps.csv", ",", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, data.Len())
+	assert.False(t, data.HasTimestamp())
+	assert.Equal(t, int64(0), data.GetTimestamp(0))
+	// With timestamps
+	report := LoadReport{}
+	data, err = ReadDataFromCSV("../example/data/timestamps.csv", ",", true,
+		WithTimestamps(), WithParsePolicy(CollectErrors), WithLoadReport(&report))
+	assert.Error(t, err)
+	assert.Equal(t, 3, data.Len())
+	assert.True(t, data.HasTimestamp())
+	assert.Equal(t, int64(881250949), data.GetTimestamp(0))
+	assert.Equal(t, int64(1136160000), data.GetTimestamp(1))
+	assert.Equal(t, int64(1136214245), data.GetTimestamp(2))
+	assert.Equal(t, 2, report.Rejected)
+	assert.Equal(t, 5, report.Errors[0].Line)
+	assert.Equal(t, 6, report.Errors[1].Line)
+	// Timestamps are kept in subsets
+	subset := data.SubSet([]int{2, 0})
+	assert.True(t, subset.HasTimestamp())
+	assert.Equal(t, int64(1136214245), subset.GetTimestamp(0))
+	assert.Equal(t, int64(881250949), subset.GetTimestamp(1))
+}
+
+func TestReadDataFromNetflixStyle_Timestamps(t *testing.T) {
+	data, err := ReadDataFromNetflixStyle("../example/data/netflix_dates.txt", ",", false, WithTimestamps())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, data.Len())
+	assert.Equal(t, int64(1136160000), data.GetTimestamp(0))
+	assert.Equal(t, int64(1136246400), data.GetTimestamp(1))
+	assert.Equal(t, int64(1136332800), data.GetTimestamp(2))
+}
+
 func TestLoadDataFromNetflixStyle(t *testing.T) {
 	data := LoadDataFromNetflixStyle("../example/data/netflix.txt", ",", true)
 	assert.Equal(t, 5, data.Len())
@@ -83,3 +226,247 @@ func TestLoadDataFromNetflixStyle(t *testing.T) {
 		assert.Equal(t, i, denseItemId)
 	}
 }
+
+// sqlTesterDriver is an in-memory database/sql driver. Each DSN names a table
+// in sqlTesterTables, which is returned by any query.
+type sqlTesterDriver struct{}
+
+type sqlTesterConn struct {
+	rows [][]driver.Value
+}
+
+type sqlTesterStmt struct {
+	conn  *sqlTesterConn
+	query string
+}
+
+type sqlTesterRows struct {
+	rows [][]driver.Value
+	pos  int
+}
+
+var sqlTesterTables = map[string][][]driver.Value{
+	"ratings": {
+		{int64(0), int64(0), 0.0},
+		{int64(1), int64(2), 3.0},
+		{int64(2), int64(4), 6.0},
+		{int64(3), int64(6), 9.0},
+		{int64(4), int64(8), 12.0},
+	},
+	"invalid": {
+		{int64(0), int64(0), 0.0},
+		{"a", int64(2), 3.0},
+	},
+	"nulls": {
+		{int64(0), int64(0), 0.0},
+		{int64(1), nil, 3.0},
+		{int64(2), int64(4), nil},
+	},
+	"timestamps": {
+		{int64(0), int64(0), 5.0, int64(881250949)},
+		{int64(1), int64(1), 3.0, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{int64(2), int64(2), 4.0, "2006-01-02"},
+	},
+	"string_ids": {
+		{"a3f1c2de", []byte("SKU-1001"), 5.0},
+		{"b7e9d410", []byte("SKU-1002"), 3.0},
+		{"a3f1c2de", []byte("SKU-1003"), 4.0},
+	},
+}
+
+var sqlTesterQueries []string
+
+func (sqlTesterDriver) Open(name string) (driver.Conn, error) {
+	rows, exist := sqlTesterTables[name]
+	if !exist {
+		return nil, errors.New("no such table " + name)
+	}
+	return &sqlTesterConn{rows}, nil
+}
+
+func (conn *sqlTesterConn) Prepare(query string) (driver.Stmt, error) {
+	sqlTesterQueries = append(sqlTesterQueries, query)
+	return &sqlTesterStmt{conn, query}, nil
+}
+
+func (conn *sqlTesterConn) Close() error {
+	return nil
+}
+
+func (conn *sqlTesterConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transaction not supported")
+}
+
+func (stmt *sqlTesterStmt) Close() error {
+	return nil
+}
+
+func (stmt *sqlTesterStmt) NumInput() int {
+	return -1
+}
+
+func (stmt *sqlTesterStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec not supported")
+}
+
+func (stmt *sqlTesterStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &sqlTesterRows{rows: stmt.conn.rows}, nil
+}
+
+func (rows *sqlTesterRows) Columns() []string {
+	columns := []string{"user_id", "item_id", "rating", "timestamp"}
+	if len(rows.rows) > 0 {
+		return columns[:len(rows.rows[0])]
+	}
+	return columns[:3]
+}
+
+func (rows *sqlTesterRows) Close() error {
+	return nil
+}
+
+func (rows *sqlTesterRows) Next(dest []driver.Value) error {
+	if rows.pos >= len(rows.rows) {
+		return io.EOF
+	}
+	copy(dest, rows.rows[rows.pos])
+	rows.pos++
+	return nil
+}
+
+func init() {
+	sql.Register("gorse-tester", sqlTesterDriver{})
+}
+
+func TestLoadDataFromSQL(t *testing.T) {
+	db, err := sql.Open("gorse-tester", "ratings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	data, err := LoadDataFromSQL(db, "SELECT user_id, item_id, rating FROM ratings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 5, data.Len())
+	for i := 0; i < data.Len(); i++ {
+		userId, itemId, value := data.Get(i)
+		assert.Equal(t, i, userId)
+		assert.Equal(t, 2*i, itemId)
+		assert.Equal(t, 3*i, int(value))
+	}
+}
+
+func TestLoadDataFromSQL_Error(t *testing.T) {
+	// Invalid value
+	db, err := sql.Open("gorse-tester", "invalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = LoadDataFromSQL(db, "SELECT user_id, item_id, rating FROM invalid")
+	assert.Error(t, err)
+	// Invalid connection
+	db, err = sql.Open("gorse-tester", "unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = LoadDataFromSQL(db, "SELECT user_id, item_id, rating FROM unknown")
+	assert.Error(t, err)
+}
+
+func TestLoadDataFromSQLTable(t *testing.T) {
+	db, err := sql.Open("gorse-tester", "ratings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	data, err := LoadDataFromSQLTable(db, SQLTable{
+		Name:         "ratings",
+		UserColumn:   "user_id",
+		ItemColumn:   "item_id",
+		RatingColumn: "rating",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 5, data.Len())
+	assert.Equal(t, "SELECT user_id, item_id, rating FROM ratings", sqlTesterQueries[len(sqlTesterQueries)-1])
+}
+
+func TestLoadDataFromSQL_StringIds(t *testing.T) {
+	db, err := sql.Open("gorse-tester", "string_ids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	data, err := LoadDataFromSQL(db, "SELECT user_id, item_id, rating FROM string_ids", WithStringIds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, data.Len())
+	assert.Equal(t, 2, data.UserCount())
+	userId, itemId, rating := data.Get(2)
+	assert.Equal(t, "a3f1c2de", data.RawUserId(userId))
+	assert.Equal(t, "SKU-1003", data.RawItemId(itemId))
+	assert.Equal(t, 4.0, rating)
+}
+
+func TestLoadDataFromSQL_ParsePolicy(t *testing.T) {
+	db, err := sql.Open("gorse-tester", "invalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	report := LoadReport{}
+	data, err := LoadDataFromSQL(db, "SELECT user_id, item_id, rating FROM invalid",
+		WithParsePolicy(SkipOnError), WithLoadReport(&report))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, data.Len())
+	assert.Equal(t, 1, report.Accepted)
+	assert.Equal(t, 1, report.Rejected)
+}
+
+func TestLoadDataFromSQL_Null(t *testing.T) {
+	db, err := sql.Open("gorse-tester", "nulls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Fail on NULL
+	_, err = LoadDataFromSQL(db, "SELECT user_id, item_id, rating FROM nulls")
+	assert.Error(t, err)
+	// Collect errors of NULL
+	report := LoadReport{}
+	data, err := LoadDataFromSQL(db, "SELECT user_id, item_id, rating FROM nulls",
+		WithParsePolicy(CollectErrors), WithLoadReport(&report))
+	assert.IsType(t, ParseErrors{}, err)
+	assert.Equal(t, 1, data.Len())
+	assert.Equal(t, 1, report.Accepted)
+	assert.Equal(t, 2, report.Rejected)
+	assert.Equal(t, []int{2, 3}, []int{report.Errors[0].Line, report.Errors[1].Line})
+}
+
+func TestLoadDataFromSQLTable_Timestamps(t *testing.T) {
+	db, err := sql.Open("gorse-tester", "timestamps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	data, err := LoadDataFromSQLTable(db, SQLTable{
+		Name:            "timestamps",
+		UserColumn:      "user_id",
+		ItemColumn:      "item_id",
+		RatingColumn:    "rating",
+		TimestampColumn: "timestamp",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "SELECT user_id, item_id, rating, timestamp FROM timestamps", sqlTesterQueries[len(sqlTesterQueries)-1])
+	assert.Equal(t, 3, data.Len())
+	assert.True(t, data.HasTimestamp())
+	assert.Equal(t, []int64{881250949, 1136214245, 1136160000},
+		[]int64{data.GetTimestamp(0), data.GetTimestamp(1), data.GetTimestamp(2)})
+}
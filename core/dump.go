@@ -3,8 +3,11 @@ package core
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
+	"github.com/zhenghaoz/gorse/base"
 	"os"
 	"path/filepath"
+	"reflect"
 )
 
 // Load a object from file.
@@ -60,3 +63,118 @@ func Copy(dst, src interface{}) error {
 	err := decoder.Decode(dst)
 	return err
 }
+
+// CopyParams copies exported fields from src to dst, where both are pointers
+// to models of the same type. The embedded BaseModel is skipped since ID sets
+// don't change during fitting.
+func CopyParams(dst, src interface{}) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src).Elem()
+	for i := 0; i < dstValue.NumField(); i++ {
+		if field := dstValue.Type().Field(i); !field.Anonymous && field.PkgPath == "" {
+			dstValue.Field(i).Set(srcValue.Field(i))
+		}
+	}
+}
+
+/* Checkpoint */
+
+// Checkpoint is the state of fitting besides model parameters.
+type Checkpoint struct {
+	Epoch          int                 // The number of finished epochs
+	GeneratorState base.GeneratorState // The state of the random generator
+	UpdaterStates  []base.UpdaterState // States of optimizers, nil if absent
+}
+
+// SaveCheckpoint saves a model and the state of fitting to a file. The file is
+// replaced atomically, so that a crash during saving doesn't break the last
+// checkpoint.
+func SaveCheckpoint(fileName string, model Model, checkpoint Checkpoint) error {
+	// Create all directories
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return err
+	}
+	tempName := fileName + ".tmp"
+	file, err := os.Create(tempName)
+	if err != nil {
+		return err
+	}
+	encoder := gob.NewEncoder(file)
+	if err = encoder.Encode(checkpoint); err == nil {
+		err = encoder.Encode(model)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempName, fileName)
+}
+
+// LoadCheckpoint loads a model and the state of fitting from a file. Model
+// parameters are copied to the model by CopyParams. An error is returned if
+// shapes of saved parameters don't match the model, e.g. the checkpoint is
+// saved by fitting on another training set.
+func LoadCheckpoint(fileName string, model Model) (Checkpoint, error) {
+	var checkpoint Checkpoint
+	file, err := os.Open(fileName)
+	if err != nil {
+		return checkpoint, err
+	}
+	defer file.Close()
+	decoder := gob.NewDecoder(file)
+	if err = decoder.Decode(&checkpoint); err != nil {
+		return checkpoint, err
+	}
+	saved := reflect.New(reflect.TypeOf(model).Elem()).Interface()
+	if err = decoder.Decode(saved); err != nil {
+		return checkpoint, err
+	}
+	if err = checkShapes(model, saved); err != nil {
+		return checkpoint, err
+	}
+	CopyParams(model, saved)
+	return checkpoint, nil
+}
+
+// checkShapes checks that exported fields copied by CopyParams have the same
+// shapes in dst and src.
+func checkShapes(dst, src interface{}) error {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src).Elem()
+	for i := 0; i < dstValue.NumField(); i++ {
+		if field := dstValue.Type().Field(i); !field.Anonymous && field.PkgPath == "" &&
+			!sameShape(dstValue.Field(i), srcValue.Field(i)) {
+			return fmt.Errorf("shape of %s doesn't match the model", field.Name)
+		}
+	}
+	return nil
+}
+
+// sameShape compares lengths of (nested) slices and dimensions of matrices.
+func sameShape(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		if a.Type().Elem().Kind() == reflect.Slice {
+			for i := 0; i < a.Len(); i++ {
+				if !sameShape(a.Index(i), b.Index(i)) {
+					return false
+				}
+			}
+		}
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if matrix, ok := a.Interface().(interface{ Dims() (int, int) }); ok {
+			aRows, aCols := matrix.Dims()
+			bRows, bCols := b.Interface().(interface{ Dims() (int, int) }).Dims()
+			return aRows == bRows && aCols == bCols
+		}
+	}
+	return true
+}
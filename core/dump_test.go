@@ -2,6 +2,8 @@ package core
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"gonum.org/v1/gonum/mat"
 	"path/filepath"
 	"testing"
 )
@@ -46,3 +48,49 @@ func TestCopy(t *testing.T) {
 	assert.Equal(t, []float64{1, 3, 0, 1, 7, 8, 7, 0, 3, 0, 0}, estimator2.Public)
 	assert.Equal(t, 0, len(estimator2.private))
 }
+
+type ShapeTesterModel struct {
+	CVTesterModel
+	Factor []float64
+}
+
+func TestSaveCheckpoint(t *testing.T) {
+	fileName := filepath.Join(TempDir, "/checkpoint.m")
+	// Save a checkpoint
+	model := &CVTesterModel{GlobalMean: 1, UserMeans: map[int]float64{1: 2}}
+	checkpoint := Checkpoint{Epoch: 3, GeneratorState: base.NewRandomGenerator(1).State()}
+	if err := SaveCheckpoint(fileName, model, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	// Load the checkpoint
+	loaded := &CVTesterModel{GlobalMean: 4}
+	ret, err := LoadCheckpoint(fileName, loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, checkpoint, ret)
+	assert.Equal(t, model, loaded)
+	// Missing checkpoint
+	_, err = LoadCheckpoint(filepath.Join(TempDir, "/missing.m"), loaded)
+	assert.Error(t, err)
+	// Mismatched shapes
+	if err = SaveCheckpoint(fileName, &ShapeTesterModel{Factor: []float64{1, 2, 3}}, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	mismatched := &ShapeTesterModel{Factor: []float64{4, 5}}
+	_, err = LoadCheckpoint(fileName, mismatched)
+	assert.Error(t, err)
+	assert.Equal(t, []float64{4, 5}, mismatched.Factor)
+}
+
+func TestCheckShapes(t *testing.T) {
+	type shapeTester struct {
+		Factor [][]float64
+		Matrix *mat.Dense
+	}
+	a := &shapeTester{Factor: [][]float64{{1, 2}, {3, 4}}, Matrix: mat.NewDense(2, 3, nil)}
+	assert.Nil(t, checkShapes(a, &shapeTester{Factor: [][]float64{{0, 0}, {0, 0}}, Matrix: mat.NewDense(2, 3, nil)}))
+	assert.Error(t, checkShapes(a, &shapeTester{Factor: [][]float64{{0, 0}, {0}}, Matrix: mat.NewDense(2, 3, nil)}))
+	assert.Error(t, checkShapes(a, &shapeTester{Factor: [][]float64{{0, 0}, {0, 0}}, Matrix: mat.NewDense(3, 2, nil)}))
+	assert.Error(t, checkShapes(a, &shapeTester{Factor: [][]float64{{0, 0}, {0, 0}}}))
+}
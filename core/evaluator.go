@@ -2,16 +2,26 @@ package core
 
 import (
 	"github.com/zhenghaoz/gorse/base"
+	"gonum.org/v1/gonum/floats"
 	"math"
+	"sort"
 )
 
 type EvaluatorOptions struct {
-	trainSet DataSet
-	nJobs    int
+	trainSet   DataSet
+	nJobs      int
+	result     *EvaluationResult
+	nNegatives int
+	sampler    Sampler
+	seed       int64
+	threshold  float64
+	graded     bool
 }
 
 func NewEvaluatorOptions(isRanking bool, option []EvaluatorOption) *EvaluatorOptions {
 	options := new(EvaluatorOptions)
+	options.nJobs = 1
+	options.threshold = math.Inf(-1)
 	for _, opt := range option {
 		opt(options)
 	}
@@ -26,43 +36,313 @@ func WithTrainSet(trainSet DataSet) EvaluatorOption {
 	}
 }
 
+// WithJobs sets the number of jobs used by ranking evaluators. Users are
+// evaluated in parallel if n > 1, where the model should be safe to predict
+// concurrently. Results are same as the sequential version. n < 1 is treated
+// as 1.
 func WithJobs(n int) EvaluatorOption {
 	return func(options *EvaluatorOptions) {
+		if n < 1 {
+			n = 1
+		}
 		options.nJobs = n
 	}
 }
 
+// WithRelevanceThreshold treats items rated no less than the threshold in the
+// test set as relevant items. Users without relevant items are skipped by
+// ranking evaluators based on relevant items (NDCG, HR, Precision, Recall, MAP,
+// MRR and Serendipity). All items in the test set are relevant by default.
+func WithRelevanceThreshold(threshold float64) EvaluatorOption {
+	return func(options *EvaluatorOptions) {
+		options.threshold = threshold
+	}
+}
+
+// WithGradedGain uses graded gains 2^{rel}-1 taken from ratings of relevant
+// items in NDCG instead of binary gains.
+func WithGradedGain() EvaluatorOption {
+	return func(options *EvaluatorOptions) {
+		options.graded = true
+	}
+}
+
+// relevantSet finds relevant items of a user in the test set.
+func (options *EvaluatorOptions) relevantSet(testSet DataSet, denseUserId int) map[int]float64 {
+	set := make(map[int]float64)
+	testSet.DenseUserRatings[denseUserId].ForEach(func(i, index int, value float64) {
+		if value >= options.threshold {
+			set[testSet.ItemIdSet.ToSparseId(index)] = value
+		}
+	})
+	return set
+}
+
+// skip returns true if a user has no relevant items. No user is skipped if
+// the relevance threshold is not set.
+func (options *EvaluatorOptions) skip(testSet DataSet, denseUserId int) bool {
+	if math.IsInf(options.threshold, -1) {
+		return false
+	}
+	for _, value := range testSet.DenseUserRatings[denseUserId].Values {
+		if value >= options.threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// gain returns the gain of a relevant item.
+func (options *EvaluatorOptions) gain(rating float64) float64 {
+	if options.graded {
+		return math.Pow(2, rating) - 1
+	}
+	return 1
+}
+
+// WithNegatives ranks each positive item in the test set among n sampled
+// negative items instead of all items. It's supported by NewHR and NewNDCG.
+func WithNegatives(n int, sampler Sampler) EvaluatorOption {
+	return func(options *EvaluatorOptions) {
+		options.nNegatives = n
+		options.sampler = sampler
+	}
+}
+
+// WithSeed sets the random seed used to sample negative items. Default is 0.
+func WithSeed(seed int64) EvaluatorOption {
+	return func(options *EvaluatorOptions) {
+		options.seed = seed
+	}
+}
+
+// WithResult fills the result with per-user scores (ranking metrics) or
+// per-rating scores (rating metrics) along with the aggregate score.
+func WithResult(result *EvaluationResult) EvaluatorOption {
+	return func(options *EvaluatorOptions) {
+		options.result = result
+	}
+}
+
+// EvaluationResult contains the aggregate score and scores of users (ranking
+// metrics) or ratings (rating metrics).
+type EvaluationResult struct {
+	Score      float64   // The aggregate score
+	UserIds    []int     // Users of scores
+	ItemIds    []int     // Items of scores, nil for ranking metrics
+	RawUserIds []string  // Raw IDs of users of scores
+	RawItemIds []string  // Raw IDs of items of scores, nil for ranking metrics
+	Scores     []float64 // Scores of users or ratings
+	aggregate  func(scores []float64) float64
+}
+
+// Bucket contains the aggregate score of a group of scores.
+type Bucket struct {
+	Low   int     // The lower bound of keys (inclusive)
+	High  int     // The upper bound of keys (exclusive)
+	Count int     // The number of scores
+	Score float64 // The aggregate score, NaN if the bucket is empty
+}
+
+// fillUsers fills the result with scores of users.
+func (result *EvaluationResult) fillUsers(score float64, testSet DataSet, userIds []int, scores []float64) {
+	if result != nil {
+		result.Score = score
+		result.UserIds = userIds
+		result.ItemIds = nil
+		result.RawUserIds = make([]string, len(userIds))
+		for i, userId := range userIds {
+			result.RawUserIds[i] = testSet.RawUserId(userId)
+		}
+		result.RawItemIds = nil
+		result.Scores = scores
+		result.aggregate = mean
+	}
+}
+
+// fillScore fills the result with the aggregate score only.
+func (result *EvaluationResult) fillScore(score float64) {
+	if result != nil {
+		result.Score = score
+		result.UserIds = nil
+		result.ItemIds = nil
+		result.RawUserIds = nil
+		result.RawItemIds = nil
+		result.Scores = nil
+		result.aggregate = mean
+	}
+}
+
+// fillRatings fills the result with scores of ratings.
+func (result *EvaluationResult) fillRatings(score float64, testSet DataSet, scores []float64,
+	aggregate func([]float64) float64) {
+	if result != nil {
+		result.Score = score
+		result.UserIds = make([]int, testSet.Len())
+		result.ItemIds = make([]int, testSet.Len())
+		result.RawUserIds = make([]string, testSet.Len())
+		result.RawItemIds = make([]string, testSet.Len())
+		for i := 0; i < testSet.Len(); i++ {
+			result.UserIds[i], result.ItemIds[i], _ = testSet.Get(i)
+			result.RawUserIds[i] = testSet.RawUserId(result.UserIds[i])
+			result.RawItemIds[i] = testSet.RawItemId(result.ItemIds[i])
+		}
+		result.Scores = scores
+		result.aggregate = aggregate
+	}
+}
+
+// Bucket groups scores by keys of users and aggregates scores in each group.
+// Keys are split into ranges by bounds:
+//   [bounds[0], bounds[1]), [bounds[1], bounds[2]), ..., [bounds[n-1], +inf)
+// Scores with keys less than bounds[0] are ignored. Scores in a bucket are
+// aggregated in the same way as the metric, for example, the root mean square
+// of absolute errors for RMSE.
+func (result *EvaluationResult) Bucket(key func(userId int) int, bounds ...int) []Bucket {
+	buckets := make([]Bucket, len(bounds))
+	groups := make([][]float64, len(bounds))
+	for i := range buckets {
+		buckets[i].Low = bounds[i]
+		buckets[i].High = math.MaxInt
+		if i+1 < len(bounds) {
+			buckets[i].High = bounds[i+1]
+		}
+	}
+	for i, userId := range result.UserIds {
+		k := key(userId)
+		for j := range buckets {
+			if k >= buckets[j].Low && k < buckets[j].High {
+				groups[j] = append(groups[j], result.Scores[i])
+				break
+			}
+		}
+	}
+	for i := range buckets {
+		buckets[i].Count = len(groups[i])
+		buckets[i].Score = math.NaN()
+		if len(groups[i]) > 0 {
+			buckets[i].Score = result.aggregate(groups[i])
+		}
+	}
+	return buckets
+}
+
+// BucketByTrainCount groups scores by the number of ratings of users in the
+// training set. For example, light users and heavy users are compared by
+//   result.BucketByTrainCount(trainSet, 0, 20, 100)
+func (result *EvaluationResult) BucketByTrainCount(trainSet DataSet, bounds ...int) []Bucket {
+	return result.Bucket(func(userId int) int {
+		denseUserId := trainSet.UserIdSet.ToDenseId(userId)
+		if denseUserId == base.NotId {
+			return 0
+		}
+		return trainSet.DenseUserRatings[denseUserId].Len()
+	}, bounds...)
+}
+
+// mean returns the mean of scores.
+func mean(scores []float64) float64 {
+	sum := 0.0
+	for _, score := range scores {
+		sum += score
+	}
+	return sum / float64(len(scores))
+}
+
+// rootMeanSquare returns the root mean square of scores.
+func rootMeanSquare(scores []float64) float64 {
+	sum := 0.0
+	for _, score := range scores {
+		sum += score * score
+	}
+	return math.Sqrt(sum / float64(len(scores)))
+}
+
 // Evaluator evaluates the performance of a estimator on the test set.
 type Evaluator func(estimator Model, testSet DataSet, option ...EvaluatorOption) float64
 
-// RMSE is root mean square error.
+// RMSE is root mean square error. The per-rating score is the absolute error.
 func RMSE(estimator Model, testSet DataSet, option ...EvaluatorOption) float64 {
+	options := NewEvaluatorOptions(false, option)
+	scores := make([]float64, testSet.Len())
 	sum := 0.0
 	for j := 0; j < testSet.Len(); j++ {
 		userId, itemId, rating := testSet.Get(j)
 		prediction := estimator.Predict(userId, itemId)
+		scores[j] = math.Abs(prediction - rating)
 		sum += (prediction - rating) * (prediction - rating)
 	}
-	return math.Sqrt(sum / float64(testSet.Len()))
+	score := math.Sqrt(sum / float64(testSet.Len()))
+	options.result.fillRatings(score, testSet, scores, rootMeanSquare)
+	return score
 }
 
-// MAE is mean absolute error.
+// MAE is mean absolute error. The per-rating score is the absolute error.
 func MAE(estimator Model, testSet DataSet, option ...EvaluatorOption) float64 {
+	options := NewEvaluatorOptions(false, option)
+	scores := make([]float64, testSet.Len())
 	sum := 0.0
 	for j := 0; j < testSet.Len(); j++ {
 		userId, itemId, rating := testSet.Get(j)
 		prediction := estimator.Predict(userId, itemId)
+		scores[j] = math.Abs(prediction - rating)
 		sum += math.Abs(prediction - rating)
 	}
-	return sum / float64(testSet.Len())
+	score := sum / float64(testSet.Len())
+	options.result.fillRatings(score, testSet, scores, mean)
+	return score
+}
+
+// meanUsers evaluates all users in parallel and returns the mean score.
+func meanUsers(testSet DataSet, options *EvaluatorOptions, score func(denseUserId int) float64) float64 {
+	return averageUsers(testSet, options, false, score)
+}
+
+// meanRelevantUsers evaluates users in parallel and returns the mean score,
+// where users without relevant items are skipped. It's used by metrics based
+// on relevant items.
+func meanRelevantUsers(testSet DataSet, options *EvaluatorOptions, score func(denseUserId int) float64) float64 {
+	return averageUsers(testSet, options, true, score)
+}
+
+// averageUsers evaluates users in parallel and returns the mean score. Scores
+// are summed in the order of users, so that the result doesn't depend on the
+// number of jobs. Users without relevant items are skipped if skipIrrelevant
+// is true. The score is 0 if all users are skipped.
+func averageUsers(testSet DataSet, options *EvaluatorOptions, skipIrrelevant bool, score func(denseUserId int) float64) float64 {
+	scores := make([]float64, testSet.UserCount())
+	skipped := make([]bool, testSet.UserCount())
+	base.Parallel(len(scores), options.nJobs, func(begin, end int) {
+		for u := begin; u < end; u++ {
+			if skipped[u] = skipIrrelevant && options.skip(testSet, u); !skipped[u] {
+				scores[u] = score(u)
+			}
+		}
+	})
+	userIds := make([]int, 0, len(scores))
+	userScores := make([]float64, 0, len(scores))
+	sum := 0.0
+	for u, score := range scores {
+		if !skipped[u] {
+			sum += score
+			userIds = append(userIds, testSet.UserIdSet.ToSparseId(u))
+			userScores = append(userScores, score)
+		}
+	}
+	meanScore := 0.0
+	if len(userScores) > 0 {
+		meanScore = sum / float64(len(userScores))
+	}
+	options.result.fillUsers(meanScore, testSet, userIds, userScores)
+	return meanScore
 }
 
 // AUC evaluator.
 func AUC(estimator Model, testSet DataSet, option ...EvaluatorOption) float64 {
 	options := NewEvaluatorOptions(true, option)
-	sum, count := 0.0, 0.0
-	// Find all userIds
-	for denseUserIdInTest, userRating := range testSet.DenseUserRatings {
+	// \frac{1}{|U|} \sum_u \frac{1}{|E(u)|} \sum_{(i,j)\in{E(u)}} I(\hat{x}_{ui} - \hat{x}_{uj})
+	return meanUsers(testSet, options, func(denseUserIdInTest int) float64 {
+		userRating := testSet.DenseUserRatings[denseUserIdInTest]
 		userId := testSet.UserIdSet.ToSparseId(denseUserIdInTest)
 		// Find all <userId, j>s in training data set and test data set.
 		denseUserIdInTrain := options.trainSet.UserIdSet.ToDenseId(userId)
@@ -77,16 +357,17 @@ func AUC(estimator Model, testSet DataSet, option ...EvaluatorOption) float64 {
 			itemId := testSet.ItemIdSet.ToSparseId(index)
 			positiveSet[itemId] = value
 		})
+		// Predict all items in test data set
+		scores := PredictItems(estimator, userId, testSet.ItemIdSet.SparseIds)
 		// Find all <userId, i>s in test data set
 		correctCount, pairCount := 0.0, 0.0
 		userRating.ForEach(func(i, index int, value float64) {
-			posItemId := testSet.ItemIdSet.ToSparseId(index)
 			// Find all <userId, j>s not in full data set
 			for j := 0; j < testSet.ItemCount(); j++ {
 				negItemId := testSet.ItemIdSet.ToSparseId(j)
 				if _, exist := positiveSet[negItemId]; !exist {
 					// I(\hat{x}_{ui} - \hat{x}_{uj})
-					if estimator.Predict(userId, posItemId) > estimator.Predict(userId, negItemId) {
+					if scores[index] > scores[j] {
 						correctCount++
 					}
 					pairCount++
@@ -94,42 +375,97 @@ func AUC(estimator Model, testSet DataSet, option ...EvaluatorOption) float64 {
 			}
 		})
 		// += \frac{1}{|E(u)|} \sum_{(i,j)\in{E(u)}} I(\hat{x}_{ui} - \hat{x}_{uj})
-		sum += correctCount / pairCount
-		count++
-	}
-	// \frac{1}{|U|} \sum_u \frac{1}{|E(u)|} \sum_{(i,j)\in{E(u)}} I(\hat{x}_{ui} - \hat{x}_{uj})
-	return sum / count
+		return correctCount / pairCount
+	})
 }
 
-// NewNDCG creates a Normalized Discounted Cumulative Gain evaluator.
+// NewNDCG creates a Normalized Discounted Cumulative Gain evaluator. If
+// negatives are sampled by WithNegatives, each positive item is ranked among
+// sampled negative items and the NDCG of a positive item is
+//   NDCG = \frac {1} {\log_2(rank+1)}, if rank <= n
+// where the rank starts from 1. Gains are binary unless WithGradedGain is given.
 func NewNDCG(n int) Evaluator {
 	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
 		options := NewEvaluatorOptions(true, option)
-		sum := 0.0
+		if options.nNegatives > 0 {
+			sampler := newNegativeSampler(testSet, options)
+			return meanRelevantUsers(testSet, options, func(u int) float64 {
+				ranks := sampler.rank(model, testSet, u)
+				sum := 0.0
+				for _, rank := range ranks {
+					if rank < n {
+						sum += 1.0 / math.Log2(float64(rank)+2.0)
+					}
+				}
+				return sum / float64(len(ranks))
+			})
+		}
 		// For all users
-		for u := 0; u < testSet.UserCount(); u++ {
+		return meanRelevantUsers(testSet, options, func(u int) float64 {
 			// Find top-n items in test set
-			targetSet := GetRelevantSet(testSet, u)
+			targetSet := options.relevantSet(testSet, u)
 			// Find top-n items in predictions
 			rankList := Top(testSet, u, n, options.trainSet, model)
-			// IDCG = \sum^{|REL|}_{i=1} \frac {1} {\log_2(i+1)}
+			// IDCG = \sum^{|REL|}_{i=1} \frac {2^{rel_i}-1} {\log_2(i+1)}
+			gains := make([]float64, 0, len(targetSet))
+			for _, rating := range targetSet {
+				gains = append(gains, options.gain(rating))
+			}
+			sort.Sort(sort.Reverse(sort.Float64Slice(gains)))
 			idcg := 0.0
-			for i := 0; i < len(targetSet); i++ {
+			for i := 0; i < len(gains); i++ {
 				if i < n {
-					idcg += 1.0 / math.Log2(float64(i)+2.0)
+					idcg += gains[i] / math.Log2(float64(i)+2.0)
 				}
 			}
 			// DCG = \sum^{N}_{i=1} \frac {2^{rel_i}-1} {\log_2(i+1)}
 			dcg := 0.0
 			for i, itemId := range rankList {
-				if _, exist := targetSet[itemId]; exist {
-					dcg += 1.0 / math.Log2(float64(i)+2.0)
+				if rating, exist := targetSet[itemId]; exist {
+					dcg += options.gain(rating) / math.Log2(float64(i)+2.0)
 				}
 			}
 			// NDCG = DCG / IDCG
-			sum += dcg / idcg
+			return dcg / idcg
+		})
+	}
+}
+
+// NewHR creates a Hit Ratio@N evaluator. The hit ratio of a user is 1 if any
+// item in the test set is in the top-n list, otherwise 0. If negatives are
+// sampled by WithNegatives, each positive item is ranked among sampled
+// negative items and the hit ratio of a user is the fraction of positive items
+// ranked in top-n. Both are same for leave-one-out splits.
+func NewHR(n int) Evaluator {
+	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		options := NewEvaluatorOptions(true, option)
+		if options.nNegatives > 0 {
+			sampler := newNegativeSampler(testSet, options)
+			return meanRelevantUsers(testSet, options, func(u int) float64 {
+				ranks := sampler.rank(model, testSet, u)
+				hit := 0
+				for _, rank := range ranks {
+					if rank < n {
+						hit++
+					}
+				}
+				return float64(hit) / float64(len(ranks))
+			})
 		}
-		return sum / float64(testSet.UserCount())
+		// For all users
+		return meanRelevantUsers(testSet, options, func(u int) float64 {
+			// Find top-n items in test set
+			targetSet := options.relevantSet(testSet, u)
+			// Find top-n items in predictions
+			rankList := Top(testSet, u, n, options.trainSet, model)
+			// Hit ratio
+			for _, itemId := range rankList {
+				if _, exist := targetSet[itemId]; exist {
+					return 1
+				}
+			}
+			return 0
+		})
 	}
 }
 
@@ -139,11 +475,10 @@ func NewNDCG(n int) Evaluator {
 func NewPrecision(n int) Evaluator {
 	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
 		options := NewEvaluatorOptions(true, option)
-		sum := 0.0
 		// For all users
-		for u := 0; u < testSet.UserCount(); u++ {
+		return meanRelevantUsers(testSet, options, func(u int) float64 {
 			// Find top-n items in test set
-			targetSet := GetRelevantSet(testSet, u)
+			targetSet := options.relevantSet(testSet, u)
 			// Find top-n items in predictions
 			rankList := Top(testSet, u, n, options.trainSet, model)
 			// Precision
@@ -153,9 +488,8 @@ func NewPrecision(n int) Evaluator {
 					hit++
 				}
 			}
-			sum += float64(hit) / float64(len(rankList))
-		}
-		return sum / float64(testSet.UserCount())
+			return float64(hit) / float64(len(rankList))
+		})
 	}
 }
 
@@ -165,11 +499,10 @@ func NewPrecision(n int) Evaluator {
 func NewRecall(n int) Evaluator {
 	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
 		options := NewEvaluatorOptions(true, option)
-		sum := 0.0
 		// For all users
-		for u := 0; u < testSet.UserCount(); u++ {
+		return meanRelevantUsers(testSet, options, func(u int) float64 {
 			// Find top-n items in test set
-			targetSet := GetRelevantSet(testSet, u)
+			targetSet := options.relevantSet(testSet, u)
 			// Find top-n items in predictions
 			rankList := Top(testSet, u, n, options.trainSet, model)
 			// Precision
@@ -179,9 +512,8 @@ func NewRecall(n int) Evaluator {
 					hit++
 				}
 			}
-			sum += float64(hit) / float64(len(targetSet))
-		}
-		return sum / float64(testSet.UserCount())
+			return float64(hit) / float64(len(targetSet))
+		})
 	}
 }
 
@@ -190,11 +522,10 @@ func NewRecall(n int) Evaluator {
 func NewMAP(n int) Evaluator {
 	return func(estimator Model, testSet DataSet, option ...EvaluatorOption) float64 {
 		options := NewEvaluatorOptions(true, option)
-		sum := 0.0
 		// For all users
-		for u := 0; u < testSet.UserCount(); u++ {
+		return meanRelevantUsers(testSet, options, func(u int) float64 {
 			// Find top-n items in test set
-			targetSet := GetRelevantSet(testSet, u)
+			targetSet := options.relevantSet(testSet, u)
 			// Find top-n items in predictions
 			rankList := Top(testSet, u, n, options.trainSet, estimator)
 			// MAP
@@ -206,9 +537,8 @@ func NewMAP(n int) Evaluator {
 					sumPrecision += float64(hit) / float64(i+1)
 				}
 			}
-			sum += float64(sumPrecision) / float64(len(targetSet))
-		}
-		return sum / float64(testSet.UserCount())
+			return float64(sumPrecision) / float64(len(targetSet))
+		})
 	}
 }
 
@@ -226,21 +556,329 @@ func NewMAP(n int) Evaluator {
 func NewMRR(n int) Evaluator {
 	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
 		options := NewEvaluatorOptions(true, option)
-		sum := 0.0
 		// For all users
-		for u := 0; u < testSet.UserCount(); u++ {
+		return meanRelevantUsers(testSet, options, func(u int) float64 {
 			// Find top-n items in test set
-			targetSet := GetRelevantSet(testSet, u)
+			targetSet := options.relevantSet(testSet, u)
 			// Find top-n items in predictions
 			rankList := Top(testSet, u, n, options.trainSet, model)
 			// MRR
 			for i, itemId := range rankList {
 				if _, exist := targetSet[itemId]; exist {
-					sum += 1 / float64(i+1)
-					break
+					return 1 / float64(i+1)
 				}
 			}
+			return 0
+		})
+	}
+}
+
+/* Sampled Metrics */
+
+// Sampler decides how negative items are sampled.
+type Sampler int
+
+const (
+	// UniformSampler samples negative items uniformly.
+	UniformSampler Sampler = iota
+	// PopularSampler samples negative items by the number of ratings in the
+	// training set. Items never rated in the training set are never sampled.
+	PopularSampler
+)
+
+// negativeSampler samples negative items for users in a test set.
+type negativeSampler struct {
+	*EvaluatorOptions
+	items   []int     // Candidate items
+	weights []float64 // Cumulative weights of candidate items, nil for uniform sampling
+}
+
+// newNegativeSampler creates a negativeSampler. Candidate items are items in
+// the training set and the test set.
+func newNegativeSampler(testSet DataSet, options *EvaluatorOptions) *negativeSampler {
+	sampler := &negativeSampler{EvaluatorOptions: options}
+	exist := make(map[int]bool)
+	for _, idSet := range []base.SparseIdSet{options.trainSet.ItemIdSet, testSet.ItemIdSet} {
+		for _, itemId := range idSet.SparseIds {
+			if !exist[itemId] {
+				exist[itemId] = true
+				sampler.items = append(sampler.items, itemId)
+			}
+		}
+	}
+	if options.sampler == PopularSampler {
+		sampler.weights = make([]float64, len(sampler.items))
+		sum := 0.0
+		for i, itemId := range sampler.items {
+			sum += float64(itemPopularity(options.trainSet, itemId))
+			sampler.weights[i] = sum
+		}
+	}
+	return sampler
+}
+
+// sample samples n negative items which are not rated by the user. All
+// candidate items not rated are returned if there are less than n.
+func (sampler *negativeSampler) sample(rng base.RandomGenerator, rated map[int]bool, n int) []int {
+	// Find all candidates if there are less than n
+	candidates := make([]int, 0, n)
+	for _, itemId := range sampler.items {
+		if !rated[itemId] && (sampler.weights == nil || itemPopularity(sampler.trainSet, itemId) > 0) {
+			candidates = append(candidates, itemId)
+			if len(candidates) > n {
+				break
+			}
+		}
+	}
+	if len(candidates) <= n {
+		return candidates
+	}
+	// Sample without replacement
+	negatives := make([]int, 0, n)
+	sampled := make(map[int]bool)
+	for len(negatives) < n {
+		var itemId int
+		if sampler.weights == nil {
+			itemId = sampler.items[rng.Intn(len(sampler.items))]
+		} else {
+			total := sampler.weights[len(sampler.weights)-1]
+			itemId = sampler.items[searchWeight(sampler.weights, rng.Float64()*total)]
+		}
+		if !rated[itemId] && !sampled[itemId] {
+			sampled[itemId] = true
+			negatives = append(negatives, itemId)
+		}
+	}
+	return negatives
+}
+
+// searchWeight returns the index of the first cumulative weight greater than x,
+// so that items of zero weights are never selected.
+func searchWeight(weights []float64, x float64) int {
+	return sort.Search(len(weights), func(i int) bool {
+		return weights[i] > x
+	})
+}
+
+// rank ranks each positive item of a user among negative items sampled for
+// the user. Ranks start from 0 and negative items with the same score are
+// ranked before the positive item. Negative items are sampled by a generator
+// seeded by the seed and the user, so that results don't depend on the number
+// of jobs.
+func (sampler *negativeSampler) rank(model Model, testSet DataSet, denseUserId int) []int {
+	userId := testSet.UserIdSet.ToSparseId(denseUserId)
+	// Find rated items
+	rated := make(map[int]bool)
+	if denseUserIdInTrain := sampler.trainSet.UserIdSet.ToDenseId(userId); denseUserIdInTrain != base.NotId {
+		sampler.trainSet.DenseUserRatings[denseUserIdInTrain].ForEach(func(i, index int, value float64) {
+			rated[sampler.trainSet.ItemIdSet.ToSparseId(index)] = true
+		})
+	}
+	testSet.DenseUserRatings[denseUserId].ForEach(func(i, index int, value float64) {
+		rated[testSet.ItemIdSet.ToSparseId(index)] = true
+	})
+	// Sample negative items
+	rng := base.NewRandomGenerator(sampler.seed + int64(userId))
+	negatives := sampler.sample(rng, rated, sampler.nNegatives)
+	negativeScores := PredictItems(model, userId, negatives)
+	// Rank positive items
+	positives := make([]int, 0)
+	testSet.DenseUserRatings[denseUserId].ForEach(func(i, index int, value float64) {
+		if value >= sampler.threshold {
+			positives = append(positives, testSet.ItemIdSet.ToSparseId(index))
+		}
+	})
+	ranks := make([]int, len(positives))
+	for i, score := range PredictItems(model, userId, positives) {
+		rank := 0
+		for _, negativeScore := range negativeScores {
+			if negativeScore >= score {
+				rank++
+			}
+		}
+		ranks[i] = rank
+	}
+	return ranks
+}
+
+/* Beyond-Accuracy Metrics */
+
+// topLists finds top-n items for all users in the test set in parallel.
+func topLists(model Model, testSet DataSet, n int, options *EvaluatorOptions) [][]int {
+	lists := make([][]int, testSet.UserCount())
+	base.Parallel(len(lists), options.nJobs, func(begin, end int) {
+		for u := begin; u < end; u++ {
+			lists[u] = Top(testSet, u, n, options.trainSet, model)
+		}
+	})
+	return lists
+}
+
+// itemPopularity returns the number of ratings of an item in the training set.
+func itemPopularity(trainSet DataSet, itemId int) int {
+	denseItemId := trainSet.ItemIdSet.ToDenseId(itemId)
+	if denseItemId == base.NotId {
+		return 0
+	}
+	return trainSet.DenseItemRatings[denseItemId].Len()
+}
+
+// NewCoverage creates a catalog coverage evaluator. The coverage is the
+// fraction of items in the training set recommended to at least one user.
+func NewCoverage(n int) Evaluator {
+	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		options := NewEvaluatorOptions(true, option)
+		recommended := make(map[int]bool)
+		for _, list := range topLists(model, testSet, n, options) {
+			for _, itemId := range list {
+				if options.trainSet.ItemIdSet.ToDenseId(itemId) != base.NotId {
+					recommended[itemId] = true
+				}
+			}
+		}
+		score := float64(len(recommended)) / float64(options.trainSet.ItemCount())
+		options.result.fillScore(score)
+		return score
+	}
+}
+
+// NewDiversity creates an intra-list diversity evaluator. The diversity of a
+// top-n list is the mean dissimilarity between pairs of items, where the
+// similarity is computed on ratings of items in the training set and items
+// without common ratings are dissimilar:
+//   ILD = \frac{1}{|L|(|L|-1)} \sum_{i \in L} \sum_{j \in L, j \neq i} (1 - sim(i,j))
+func NewDiversity(n int, sim base.FuncSimilarity) Evaluator {
+	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		options := NewEvaluatorOptions(true, option)
+		// Call SortIndex() to make sure similarity() reentrant, where unsorted
+		// ratings are copied to keep the training set unchanged
+		empty := base.NewSparseVector()
+		empty.SortIndex()
+		itemRatings := make([]base.SparseVector, len(options.trainSet.DenseItemRatings))
+		for i := range itemRatings {
+			itemRatings[i] = options.trainSet.DenseItemRatings[i]
+			if !itemRatings[i].Sorted {
+				itemRatings[i] = itemRatings[i].Clone()
+				itemRatings[i].SortIndex()
+			}
+		}
+		ratings := func(itemId int) *base.SparseVector {
+			denseItemId := options.trainSet.ItemIdSet.ToDenseId(itemId)
+			if denseItemId == base.NotId {
+				return empty
+			}
+			return &itemRatings[denseItemId]
+		}
+		return meanUsers(testSet, options, func(u int) float64 {
+			rankList := Top(testSet, u, n, options.trainSet, model)
+			if len(rankList) < 2 {
+				return 0
+			}
+			sum := 0.0
+			for i := range rankList {
+				for j := i + 1; j < len(rankList); j++ {
+					// Items without common ratings are dissimilar
+					if similarity := sim(ratings(rankList[i]), ratings(rankList[j])); !math.IsNaN(similarity) {
+						sum += 1 - similarity
+					} else {
+						sum++
+					}
+				}
+			}
+			return 2 * sum / float64(len(rankList)*(len(rankList)-1))
+		})
+	}
+}
+
+// NewNovelty creates a novelty evaluator. The novelty of a top-n list is the
+// mean self-information of items, where the probability of an item is the
+// fraction of users rated it in the training set. Items never rated are
+// treated as rated by one user.
+//   Novelty = \frac{1}{|L|} \sum_{i \in L} -\log_2 \frac{|U_i|}{|U|}
+func NewNovelty(n int) Evaluator {
+	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		options := NewEvaluatorOptions(true, option)
+		return meanUsers(testSet, options, func(u int) float64 {
+			rankList := Top(testSet, u, n, options.trainSet, model)
+			if len(rankList) == 0 {
+				return 0
+			}
+			sum := 0.0
+			for _, itemId := range rankList {
+				popularity := math.Max(float64(itemPopularity(options.trainSet, itemId)), 1)
+				sum -= math.Log2(popularity / float64(options.trainSet.UserCount()))
+			}
+			return sum / float64(len(rankList))
+		})
+	}
+}
+
+// NewSerendipity creates a serendipity evaluator. The serendipity of a top-n
+// list is the fraction of items which are relevant and unexpected, where
+// unexpected items are items not in the top-nPopular most popular items of
+// the training set.
+//   Serendipity = \frac{|L \cap REL \setminus POP_{nPopular}|}{|L|}
+func NewSerendipity(n, nPopular int) Evaluator {
+	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		options := NewEvaluatorOptions(true, option)
+		// Find top-nPopular popular items
+		popularity := make([]float64, options.trainSet.ItemCount())
+		indices := make([]int, options.trainSet.ItemCount())
+		for i := range popularity {
+			popularity[i] = -float64(options.trainSet.DenseItemRatings[i].Len())
+			indices[i] = i
+		}
+		floats.Argsort(popularity, indices)
+		expected := make(map[int]bool)
+		for i := 0; i < nPopular && i < len(indices); i++ {
+			expected[options.trainSet.ItemIdSet.ToSparseId(indices[i])] = true
+		}
+		return meanRelevantUsers(testSet, options, func(u int) float64 {
+			targetSet := options.relevantSet(testSet, u)
+			rankList := Top(testSet, u, n, options.trainSet, model)
+			if len(rankList) == 0 {
+				return 0
+			}
+			hit := 0
+			for _, itemId := range rankList {
+				if _, exist := targetSet[itemId]; exist && !expected[itemId] {
+					hit++
+				}
+			}
+			return float64(hit) / float64(len(rankList))
+		})
+	}
+}
+
+// NewGini creates a Gini index evaluator for the popularity bias of top-n
+// lists. Items in the training set are sorted by the number of times they
+// are recommended in ascending order:
+//   Gini = \frac{\sum^m_{i=1} (2i-m-1) c_i}{m \sum^m_{i=1} c_i}
+// where m is the number of items. It's 0 if all items are recommended equally
+// and close to 1 if only a few items are recommended. It's 0 if no item in the
+// training set is recommended.
+func NewGini(n int) Evaluator {
+	return func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		options := NewEvaluatorOptions(true, option)
+		counts := make([]float64, options.trainSet.ItemCount())
+		for _, list := range topLists(model, testSet, n, options) {
+			for _, itemId := range list {
+				if denseItemId := options.trainSet.ItemIdSet.ToDenseId(itemId); denseItemId != base.NotId {
+					counts[denseItemId]++
+				}
+			}
+		}
+		sort.Float64s(counts)
+		sum, weightedSum := 0.0, 0.0
+		for i, count := range counts {
+			sum += count
+			weightedSum += float64(2*(i+1)-len(counts)-1) * count
+		}
+		score := 0.0
+		if sum > 0 {
+			score = weightedSum / (float64(len(counts)) * sum)
 		}
-		return sum / float64(testSet.UserCount())
+		options.result.fillScore(score)
+		return score
 	}
 }
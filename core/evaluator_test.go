@@ -126,3 +126,219 @@ func TestMRR(t *testing.T) {
 	mrr := NewMRR(10)
 	t.Log(mrr(a, b))
 }
+
+func TestEvaluator_Parallel(t *testing.T) {
+	// Generate a random model and random data sets
+	rng := NewRandomGenerator(0)
+	users := rng.MakeUniformVectorInt(2000, 0, 100)
+	items := rng.MakeUniformVectorInt(2000, 0, 200)
+	ratings := rng.MakeUniformVector(2000, 0, 5)
+	model := NewEvaluatorTesterModel(users, items, ratings)
+	trainSet := NewDataSet(NewDataTable(users[:1000], items[:1000], ratings[:1000]))
+	testSet := NewDataSet(NewDataTable(users[1000:], items[1000:], ratings[1000:]))
+	// Results are same as the sequential version
+	evaluators := []Evaluator{AUC, NewNDCG(10), NewPrecision(10), NewRecall(10), NewMAP(10), NewMRR(10)}
+	for _, evaluator := range evaluators {
+		expected := evaluator(model, testSet, WithTrainSet(trainSet))
+		actual := evaluator(model, testSet, WithTrainSet(trainSet), WithJobs(4))
+		assert.Equal(t, expected, actual)
+		// Non-positive numbers of jobs are treated as 1
+		assert.Equal(t, expected, evaluator(model, testSet, WithTrainSet(trainSet), WithJobs(0)))
+		assert.Equal(t, expected, evaluator(model, testSet, WithTrainSet(trainSet), WithJobs(-1)))
+	}
+}
+
+func TestEvaluationResult(t *testing.T) {
+	// The mocked test dataset:
+	// -2.0 NaN NaN
+	//  NaN 0.0 NaN
+	//  NaN NaN 2.0
+	a := NewEvaluatorTesterModel(nil, nil, nil)
+	b := NewDataSet(NewDataTable([]int{0, 1, 2}, []int{0, 1, 2}, []float64{-2.0, 0, 2.0}))
+	result := EvaluationResult{}
+	score := RMSE(a, b, WithResult(&result))
+	assert.Equal(t, score, result.Score)
+	assert.Equal(t, []int{0, 1, 2}, result.UserIds)
+	assert.Equal(t, []int{0, 1, 2}, result.ItemIds)
+	assert.Equal(t, []float64{2, 0, 2}, result.Scores)
+	// Bucket by user IDs
+	buckets := result.Bucket(func(userId int) int { return userId }, 0, 1, 3)
+	assert.Equal(t, 3, len(buckets))
+	assert.Equal(t, []int{1, 2, 0}, []int{buckets[0].Count, buckets[1].Count, buckets[2].Count})
+	assert.Equal(t, 2.0, buckets[0].Score)
+	assert.True(t, math.Abs(buckets[1].Score-math.Sqrt2) < evalEpsilon)
+	assert.True(t, math.IsNaN(buckets[2].Score))
+}
+
+func TestEvaluationResult_RawIds(t *testing.T) {
+	data := LoadDataFromCSV("../example/data/string_ids.csv", ",", true, WithStringIds())
+	a := NewEvaluatorTesterModel(nil, nil, nil)
+	result := EvaluationResult{}
+	RMSE(a, data, WithResult(&result))
+	assert.Equal(t, []string{"a3f1c2de", "b7e9d410", "a3f1c2de", "c0d2e8f5", "b7e9d410"}, result.RawUserIds)
+	assert.Equal(t, []string{"SKU-1001", "SKU-1002", "SKU-1003", "SKU-1001", "SKU-1003"}, result.RawItemIds)
+	NewMRR(2)(a, data, WithTrainSet(data), WithResult(&result))
+	assert.Equal(t, []string{"a3f1c2de", "b7e9d410", "c0d2e8f5"}, result.RawUserIds)
+	assert.Nil(t, result.RawItemIds)
+}
+
+func TestEvaluationResult_Ranking(t *testing.T) {
+	a := NewEvaluatorTesterModel(
+		[]int{0, 0, 0, 1, 1, 1},
+		[]int{0, 1, 2, 0, 1, 2},
+		[]float64{3, 2, 1, 3, 2, 1})
+	train := NewDataSet(NewDataTable([]int{0, 1, 1}, []int{0, 0, 1}, []float64{1, 1, 1}))
+	test := NewDataSet(NewDataTable([]int{0, 1}, []int{1, 1}, []float64{1, 1}))
+	result := EvaluationResult{}
+	score := NewMRR(2)(a, test, WithTrainSet(train), WithResult(&result))
+	assert.Equal(t, 0.5, score)
+	assert.Equal(t, []int{0, 1}, result.UserIds)
+	assert.Nil(t, result.ItemIds)
+	assert.Equal(t, []float64{1, 0}, result.Scores)
+	// Bucket by the number of training ratings
+	buckets := result.BucketByTrainCount(train, 0, 2)
+	assert.Equal(t, Bucket{Low: 0, High: 2, Count: 1, Score: 1}, buckets[0])
+	assert.Equal(t, Bucket{Low: 2, High: math.MaxInt, Count: 1, Score: 0}, buckets[1])
+}
+
+func TestBeyondAccuracy(t *testing.T) {
+	// The mocked model:
+	// 0 0 4 5
+	// 0 0 5 4
+	// 0 5 0 4
+	// 5 4 0 0
+	a := NewEvaluatorTesterModel(
+		[]int{0, 0, 1, 1, 2, 2, 3, 3},
+		[]int{2, 3, 2, 3, 1, 3, 0, 1},
+		[]float64{4, 5, 5, 4, 5, 4, 5, 4})
+	train := NewDataSet(NewDataTable(
+		[]int{0, 1, 2, 0, 1, 2, 3},
+		[]int{0, 0, 0, 1, 1, 2, 2},
+		[]float64{1, 1, 1, 1, 1, 1, 1}))
+	test := NewDataSet(NewDataTable(
+		[]int{0, 0, 1, 2, 3, 3},
+		[]int{2, 3, 3, 1, 0, 1},
+		[]float64{1, 1, 1, 1, 1, 1}))
+	// Top-1 lists are [3], [2], [1], [0]
+	assert.Equal(t, 1.0, NewCoverage(1)(a, test, WithTrainSet(train)))
+	assert.Equal(t, 0.0, NewGini(1)(a, test, WithTrainSet(train)))
+	assert.Equal(t, 0.5, NewSerendipity(1, 1)(a, test, WithTrainSet(train)))
+	assert.Equal(t, 0.75, NewSerendipity(1, 0)(a, test, WithTrainSet(train)))
+	assert.Equal(t, 0.25, NewSerendipity(1, 3)(a, test, WithTrainSet(train)))
+	assert.True(t, math.Abs(NewNovelty(1)(a, test, WithTrainSet(train))-(4+math.Log2(4.0/3.0))/4) < evalEpsilon)
+	// Top-2 lists are [3, 2], [2, 3], [1, 3], [0, 1]
+	assert.Equal(t, 0.75, NewDiversity(2, CosineSimilarity)(a, test, WithTrainSet(train)))
+	// Only item 2 and item 3 (not in the training set) are recommended
+	b := NewEvaluatorTesterModel([]int{0, 1, 2, 3}, []int{2, 2, 3, 3}, []float64{1, 1, 1, 1})
+	assert.True(t, math.Abs(NewCoverage(1)(b, test, WithTrainSet(train))-1.0/3.0) < evalEpsilon)
+	assert.True(t, math.Abs(NewGini(1)(b, test, WithTrainSet(train))-2.0/3.0) < evalEpsilon)
+	// No item in the training set is recommended
+	coldTest := NewDataSet(NewDataTable([]int{0, 1}, []int{3, 3}, []float64{1, 1}))
+	assert.Equal(t, 0.0, NewGini(1)(b, coldTest, WithTrainSet(train)))
+	// The training set is unchanged
+	for i := range train.DenseItemRatings {
+		assert.False(t, train.DenseItemRatings[i].Sorted)
+	}
+}
+
+func TestSampledEvaluators(t *testing.T) {
+	data := LoadDataFromBuiltIn("ml-100k")
+	trains, tests := NewUserLOOSplitter(1)(data, 0)
+	// The model predicts ratings in the data set
+	users, items, ratings := make([]int, 0), make([]int, 0), make([]float64, 0)
+	data.ForEach(func(userId, itemId int, rating float64) {
+		users = append(users, userId)
+		items = append(items, itemId)
+		ratings = append(ratings, rating)
+	})
+	a := NewEvaluatorTesterModel(users, items, ratings)
+	for _, sampler := range []Sampler{UniformSampler, PopularSampler} {
+		options := []EvaluatorOption{WithTrainSet(trains[0]), WithNegatives(99, sampler)}
+		assert.Equal(t, 1.0, NewHR(10)(a, tests[0], options...))
+		assert.Equal(t, 1.0, NewNDCG(10)(a, tests[0], options...))
+	}
+	// The model predicts negative ratings
+	for i := range ratings {
+		ratings[i] = -ratings[i]
+	}
+	b := NewEvaluatorTesterModel(users, items, ratings)
+	options := []EvaluatorOption{WithTrainSet(trains[0]), WithNegatives(99, UniformSampler)}
+	assert.Equal(t, 0.0, NewHR(10)(b, tests[0], options...))
+	assert.Equal(t, 0.0, NewNDCG(10)(b, tests[0], options...))
+	// Results depend on the seed only
+	rng := NewRandomGenerator(0)
+	c := NewEvaluatorTesterModel(users, items, ratings)
+	for i := range c.Matrix {
+		c.Matrix[i] = rng.MakeUniformVector(len(c.Matrix[i]), 0, 5)
+	}
+	hr := NewHR(10)(c, tests[0], WithTrainSet(trains[0]), WithNegatives(99, UniformSampler), WithSeed(1))
+	assert.Equal(t, hr, NewHR(10)(c, tests[0], WithTrainSet(trains[0]), WithNegatives(99, UniformSampler),
+		WithSeed(1), WithJobs(4)))
+	assert.NotEqual(t, hr, NewHR(10)(c, tests[0], WithTrainSet(trains[0]), WithNegatives(99, UniformSampler),
+		WithSeed(2)))
+}
+
+func TestNegativeSampler(t *testing.T) {
+	train := NewDataSet(NewDataTable([]int{0, 1, 1}, []int{0, 0, 1}, []float64{1, 1, 1}))
+	test := NewDataSet(NewDataTable([]int{0, 0}, []int{2, 3}, []float64{1, 1}))
+	rng := NewRandomGenerator(0)
+	// Uniform sampler
+	sampler := newNegativeSampler(test, NewEvaluatorOptions(true,
+		[]EvaluatorOption{WithTrainSet(train), WithNegatives(2, UniformSampler)}))
+	negatives := sampler.sample(rng, map[int]bool{0: true}, 2)
+	assert.Equal(t, 2, len(negatives))
+	assert.NotContains(t, negatives, 0)
+	assert.ElementsMatch(t, []int{1, 2, 3}, sampler.sample(rng, map[int]bool{0: true}, 5))
+	// Popular sampler
+	sampler = newNegativeSampler(test, NewEvaluatorOptions(true,
+		[]EvaluatorOption{WithTrainSet(train), WithNegatives(2, PopularSampler)}))
+	assert.Equal(t, []int{1}, sampler.sample(rng, map[int]bool{0: true}, 2))
+}
+
+func TestRelevanceThreshold(t *testing.T) {
+	// The mocked model ranks items by IDs
+	a := NewEvaluatorTesterModel(
+		[]int{0, 0, 0, 0, 1, 1, 1, 1},
+		[]int{0, 1, 2, 3, 0, 1, 2, 3},
+		[]float64{4, 3, 2, 1, 4, 3, 2, 1})
+	// User 0 likes item 1 and dislikes item 0, user 1 dislikes item 2
+	test := NewDataSet(NewDataTable([]int{0, 0, 1}, []int{0, 1, 2}, []float64{1, 5, 2}))
+	assert.Equal(t, map[int]float64{1: 5}, GetRelevantSet(test, 0, WithRelevanceThreshold(4)))
+	assert.Equal(t, map[int]float64{0: 1, 1: 5}, GetRelevantSet(test, 0))
+	// Without threshold
+	assert.Equal(t, 0.5, NewMRR(2)(a, test))
+	assert.Equal(t, 0.5, NewPrecision(2)(a, test))
+	// With threshold, user 1 is skipped
+	result := EvaluationResult{}
+	assert.Equal(t, 0.5, NewMRR(2)(a, test, WithRelevanceThreshold(4), WithResult(&result)))
+	assert.Equal(t, []int{0}, result.UserIds)
+	assert.Equal(t, 0.5, NewPrecision(2)(a, test, WithRelevanceThreshold(4)))
+	assert.Equal(t, 1.0, NewRecall(2)(a, test, WithRelevanceThreshold(4)))
+	assert.Equal(t, 0.5, NewMAP(2)(a, test, WithRelevanceThreshold(4)))
+	assert.True(t, math.Abs(NewNDCG(2)(a, test, WithRelevanceThreshold(4))-1/math.Log2(3)) < evalEpsilon)
+	// AUC doesn't use the threshold
+	assert.Equal(t, AUC(a, test), AUC(a, test, WithRelevanceThreshold(4), WithResult(&result)))
+	assert.Equal(t, []int{0, 1}, result.UserIds)
+	// All users are skipped
+	assert.Equal(t, 0.0, NewMRR(2)(a, test, WithRelevanceThreshold(10)))
+}
+
+func TestNDCG_GradedGain(t *testing.T) {
+	// The mocked model ranks items by IDs
+	a := NewEvaluatorTesterModel([]int{0, 0, 0}, []int{0, 1, 2}, []float64{3, 2, 1})
+	test := NewDataSet(NewDataTable([]int{0, 0}, []int{0, 1}, []float64{1, 2}))
+	// Binary gains
+	assert.Equal(t, 1.0, NewNDCG(2)(a, test))
+	// Graded gains: DCG = 1 + 3 / log2(3), IDCG = 3 + 1 / log2(3)
+	expected := (1 + 3/math.Log2(3)) / (3 + 1/math.Log2(3))
+	assert.True(t, math.Abs(NewNDCG(2)(a, test, WithGradedGain())-expected) < evalEpsilon)
+}
+
+func TestSearchWeight(t *testing.T) {
+	// Items of zero weights are never selected
+	weights := []float64{0, 0, 2, 2, 5}
+	assert.Equal(t, 2, searchWeight(weights, 0))
+	assert.Equal(t, 2, searchWeight(weights, 1.9))
+	assert.Equal(t, 4, searchWeight(weights, 2))
+	assert.Equal(t, 4, searchWeight(weights, 4.9))
+}
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"github.com/zhenghaoz/gorse/base"
+	"gonum.org/v1/gonum/floats"
+	"math"
+)
+
+/* Recommend Options */
+
+// RecommendOptions contains options used in recommendation.
+type RecommendOptions struct {
+	candidates []int
+	blockList  map[int]bool
+	trainSet   *DataSet
+}
+
+// NewRecommendOptions creates a RecommendOptions from RecommendOption.
+func NewRecommendOptions(option []RecommendOption) *RecommendOptions {
+	options := new(RecommendOptions)
+	for _, opt := range option {
+		opt(options)
+	}
+	return options
+}
+
+// RecommendOption changes options.
+type RecommendOption func(*RecommendOptions)
+
+// WithCandidates recommends items from the candidate set instead of all items
+// in the training set.
+func WithCandidates(itemIds []int) RecommendOption {
+	return func(options *RecommendOptions) {
+		options.candidates = itemIds
+	}
+}
+
+// WithBlockList never recommends items in the block list.
+func WithBlockList(itemIds []int) RecommendOption {
+	return func(options *RecommendOptions) {
+		if options.blockList == nil {
+			options.blockList = make(map[int]bool)
+		}
+		for _, itemId := range itemIds {
+			options.blockList[itemId] = true
+		}
+	}
+}
+
+// WithExcludeRated never recommends items rated by the user in the training set.
+func WithExcludeRated(trainSet DataSet) RecommendOption {
+	return func(options *RecommendOptions) {
+		options.trainSet = &trainSet
+	}
+}
+
+// Candidates returns candidate items for a user. Candidates are given by
+// WithCandidates or all items otherwise, where items in the block list and
+// items rated by the user are removed.
+func (options *RecommendOptions) Candidates(userId int, allItems []int) []int {
+	candidates := allItems
+	if options.candidates != nil {
+		candidates = options.candidates
+	}
+	// Find rated items
+	rated := make(map[int]bool)
+	if options.trainSet != nil {
+		denseUserId := options.trainSet.UserIdSet.ToDenseId(userId)
+		if denseUserId != base.NotId {
+			options.trainSet.DenseUserRatings[denseUserId].ForEach(func(i, index int, value float64) {
+				rated[options.trainSet.ItemIdSet.ToSparseId(index)] = true
+			})
+		}
+	}
+	// Remove excluded items
+	ret := make([]int, 0, len(candidates))
+	for _, itemId := range candidates {
+		if !rated[itemId] && !options.blockList[itemId] {
+			ret = append(ret, itemId)
+		}
+	}
+	return ret
+}
+
+/* Recommend Helpers */
+
+// PredictItems predicts ratings given by a user to a list of items. Ratings
+// are predicted in a batch if the model is a BatchPredictor, otherwise one by one.
+func PredictItems(model Model, userId int, itemIds []int) []float64 {
+	if predictor, ok := model.(BatchPredictor); ok {
+		return predictor.PredictItems(userId, itemIds)
+	}
+	scores := make([]float64, len(itemIds))
+	for i, itemId := range itemIds {
+		scores[i] = model.Predict(userId, itemId)
+	}
+	return scores
+}
+
+// RecommendByPredict recommends top-n items to a user by predicting ratings
+// of candidate items, where allItems are used if no candidate is given. It's
+// the default implementation of Recommender.
+func RecommendByPredict(model Model, userId int, n int, allItems []int, option ...RecommendOption) ([]int, []float64) {
+	candidates := NewRecommendOptions(option).Candidates(userId, allItems)
+	scores := PredictItems(model, userId, candidates)
+	return TopItems(candidates, scores, n)
+}
+
+// RecommendRaw recommends top-n items to a user by raw IDs, where raw IDs are
+// converted by ids, for example, the training set or the model. Items in
+// options are given by IDs, which could be converted by ids.ItemId.
+func RecommendRaw(recommender Recommender, ids RawIdMapper, rawUserId string, n int, option ...RecommendOption) ([]string, []float64) {
+	items, scores := recommender.Recommend(ids.UserId(rawUserId), n, option...)
+	rawItems := make([]string, len(items))
+	for i, itemId := range items {
+		rawItems[i] = ids.RawItemId(itemId)
+	}
+	return rawItems, scores
+}
+
+// TopItems returns top-n items and their scores in descending order of scores.
+func TopItems(itemIds []int, scores []float64, n int) ([]int, []float64) {
+	// Sort items
+	negScores := make([]float64, len(scores))
+	indices := make([]int, len(scores))
+	for i := range scores {
+		negScores[i] = -scores[i]
+	}
+	floats.Argsort(negScores, indices)
+	// Get top-n list
+	if n > len(indices) {
+		n = len(indices)
+	}
+	topItems := make([]int, n)
+	topScores := make([]float64, n)
+	for i := 0; i < n; i++ {
+		topItems[i] = itemIds[indices[i]]
+		topScores[i] = -negScores[i]
+	}
+	return topItems, topScores
+}
+
+/* Similar Helpers */
+
+// SimilarItems finds top-n items most similar to an item, where similarities
+// are computed by sim between ratings in DenseItemRatings. It's the generic
+// implementation of SimilarFinder.
+func SimilarItems(dataSet DataSet, itemId int, n int, sim base.FuncSimilarity) ([]int, []float64) {
+	return SimilarByRatings(dataSet.DenseItemRatings, dataSet.ItemIdSet, itemId, n, sim)
+}
+
+// SimilarUsers finds top-n users most similar to a user, where similarities
+// are computed by sim between ratings in DenseUserRatings. It's the generic
+// implementation of SimilarFinder.
+func SimilarUsers(dataSet DataSet, userId int, n int, sim base.FuncSimilarity) ([]int, []float64) {
+	return SimilarByRatings(dataSet.DenseUserRatings, dataSet.UserIdSet, userId, n, sim)
+}
+
+// SimilarByRatings finds top-n IDs most similar to an ID, where ratings[i]
+// are ratings of the i-th ID in the ID set. Nothing is returned if the ID
+// doesn't exist.
+func SimilarByRatings(ratings []base.SparseVector, idSet base.SparseIdSet, id int, n int, sim base.FuncSimilarity) ([]int, []float64) {
+	denseId := idSet.ToDenseId(id)
+	if denseId == base.NotId {
+		return []int{}, []float64{}
+	}
+	similarities := make([]float64, len(ratings))
+	for i := range ratings {
+		if i != denseId {
+			similarities[i] = sim(&ratings[denseId], &ratings[i])
+		}
+	}
+	return TopSimilar(idSet.SparseIds, similarities, id, n)
+}
+
+// TopSimilar returns top-n IDs and their similarities in descending order of
+// similarities, where the excluded ID and IDs with NaN similarities are skipped.
+func TopSimilar(ids []int, similarities []float64, excludedId int, n int) ([]int, []float64) {
+	candidates := make([]int, 0, len(ids))
+	scores := make([]float64, 0, len(ids))
+	for i, id := range ids {
+		if id != excludedId && !math.IsNaN(similarities[i]) {
+			candidates = append(candidates, id)
+			scores = append(scores, similarities[i])
+		}
+	}
+	return TopItems(candidates, scores, n)
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"math"
+	"testing"
+)
+
+func TestRecommendOptions(t *testing.T) {
+	train := NewDataSet(NewDataTable([]int{0, 0, 1}, []int{0, 1, 2}, []float64{1, 1, 1}))
+	allItems := []int{0, 1, 2, 3, 4}
+	// All items
+	options := NewRecommendOptions(nil)
+	assert.Equal(t, allItems, options.Candidates(0, allItems))
+	// Exclude rated items
+	options = NewRecommendOptions([]RecommendOption{WithExcludeRated(train)})
+	assert.Equal(t, []int{2, 3, 4}, options.Candidates(0, allItems))
+	assert.Equal(t, allItems, options.Candidates(2, allItems))
+	// Block list and candidates
+	options = NewRecommendOptions([]RecommendOption{
+		WithExcludeRated(train), WithBlockList([]int{3}), WithCandidates([]int{1, 3, 4, 5})})
+	assert.Equal(t, []int{4, 5}, options.Candidates(0, allItems))
+}
+
+func TestTopItems(t *testing.T) {
+	items, scores := TopItems([]int{10, 11, 12, 13}, []float64{1, 4, 2, 3}, 3)
+	assert.Equal(t, []int{11, 13, 12}, items)
+	assert.Equal(t, []float64{4, 3, 2}, scores)
+	items, scores = TopItems([]int{10, 11}, []float64{1, 4}, 3)
+	assert.Equal(t, []int{11, 10}, items)
+	assert.Equal(t, []float64{4, 1}, scores)
+}
+
+func TestRecommendByPredict(t *testing.T) {
+	a := NewEvaluatorTesterModel([]int{0, 0, 0, 0}, []int{0, 1, 2, 3}, []float64{4, 3, 2, 1})
+	train := NewDataSet(NewDataTable([]int{0}, []int{1}, []float64{1}))
+	items, scores := RecommendByPredict(a, 0, 2, []int{0, 1, 2, 3}, WithExcludeRated(train))
+	assert.Equal(t, []int{0, 2}, items)
+	assert.Equal(t, []float64{4, 2}, scores)
+	// Top falls back to Predict
+	test := NewDataSet(NewDataTable([]int{0, 0, 0}, []int{1, 2, 3}, []float64{1, 1, 1}))
+	assert.Equal(t, []int{2, 3}, Top(test, 0, 2, train, a))
+}
+
+func TestPredictItems(t *testing.T) {
+	a := NewEvaluatorTesterModel([]int{0, 0, 0, 0}, []int{0, 1, 2, 3}, []float64{4, 3, 2, 1})
+	assert.Equal(t, []float64{2, 4, 0}, PredictItems(a, 0, []int{2, 0, 5}))
+	assert.Equal(t, []float64{}, PredictItems(a, 0, nil))
+}
+
+func TestTopSimilar(t *testing.T) {
+	ids, similarities := TopSimilar([]int{10, 11, 12, 13}, []float64{1, 4, math.NaN(), 3}, 11, 3)
+	assert.Equal(t, []int{13, 10}, ids)
+	assert.Equal(t, []float64{3, 1}, similarities)
+}
+
+func TestSimilarItems(t *testing.T) {
+	data := NewDataSet(NewDataTable(
+		[]int{0, 0, 0, 1, 1, 1, 2, 2},
+		[]int{0, 1, 2, 0, 1, 2, 0, 3},
+		[]float64{5, 5, 1, 4, 4, 2, 1, 3}))
+	// Items
+	items, similarities := SimilarItems(data, 0, 2, base.MSDSimilarity)
+	assert.Equal(t, []int{1, 3}, items)
+	assert.Equal(t, []float64{1, 1.0 / 5}, similarities)
+	items, _ = SimilarItems(data, 4, 2, base.MSDSimilarity)
+	assert.Equal(t, []int{}, items)
+	// Users
+	users, similarities := SimilarUsers(data, 0, 2, base.MSDSimilarity)
+	assert.Equal(t, []int{1, 2}, users)
+	assert.Equal(t, []float64{1.0 / 2, 1.0 / 17}, similarities)
+}
@@ -2,7 +2,9 @@ package core
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
 	"math"
+	"math/rand"
 	"testing"
 )
 
@@ -33,6 +35,23 @@ func TestUserLOOSplitter(t *testing.T) {
 	}
 }
 
+func TestUserLOOSplitter_Timestamps(t *testing.T) {
+	data := NewTimedDataTable(
+		[]int{0, 0, 1, 1, 1},
+		[]int{0, 1, 0, 1, 2},
+		[]float64{1, 2, 3, 4, 5},
+		[]int64{10, 20, 30, 40, 50})
+	loo := NewUserLOOSplitter(1)
+	trains, tests := loo(data, 0)
+	for _, fold := range []DataSet{trains[0], tests[0]} {
+		assert.True(t, fold.HasTimestamp())
+		for i := 0; i < fold.Len(); i++ {
+			_, _, rating := fold.Get(i)
+			assert.Equal(t, int64(rating*10), fold.GetTimestamp(i))
+		}
+	}
+}
+
 func TestUserKeepNSplitter(t *testing.T) {
 	data := LoadDataFromBuiltIn("ml-100k")
 	keep := NewUserKeepNSplitter(1, 3, 0.2)
@@ -46,3 +65,155 @@ func TestUserKeepNSplitter(t *testing.T) {
 	assert.True(t,
 		math.Abs(float64(data.UserCount())*0.2-float64(nCount)) < 1)
 }
+
+func newTimedTestTable() *DataTable {
+	return NewTimedDataTable(
+		[]int{0, 0, 0, 1, 1, 1, 2, 2, 2, 2},
+		[]int{0, 1, 2, 0, 1, 2, 0, 1, 2, 3},
+		[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		[]int64{30, 10, 20, 40, 60, 50, 70, 80, 90, 90})
+}
+
+func TestTimeCutoffSplitter(t *testing.T) {
+	data := newTimedTestTable()
+	cutoff := NewTimeCutoffSplitter(50)
+	trains, tests := cutoff(data, 0)
+	assert.Equal(t, 4, trains[0].Len())
+	assert.Equal(t, 6, tests[0].Len())
+	for i := 0; i < trains[0].Len(); i++ {
+		assert.True(t, trains[0].GetTimestamp(i) < 50)
+	}
+	for i := 0; i < tests[0].Len(); i++ {
+		assert.True(t, tests[0].GetTimestamp(i) >= 50)
+	}
+	// Timestamps are required
+	assert.Panics(t, func() {
+		cutoff(NewDataTable([]int{0}, []int{0}, []float64{0}), 0)
+	})
+}
+
+func TestUserLastNSplitter(t *testing.T) {
+	data := newTimedTestTable()
+	lastN := NewUserLastNSplitter(2)
+	trains, tests := lastN(data, 0)
+	ratings := func(set DataSet) []float64 {
+		values := make([]float64, 0)
+		set.ForEach(func(userId, itemId int, rating float64) {
+			values = append(values, rating)
+		})
+		return values
+	}
+	assert.Equal(t, []float64{2, 4, 7, 8}, ratings(trains[0]))
+	assert.Equal(t, []float64{3, 1, 6, 5, 9, 10}, ratings(tests[0]))
+}
+
+func TestRollingOriginSplitter(t *testing.T) {
+	data := newTimedTestTable()
+	// Expanding window
+	rolling := NewRollingOriginSplitter(3, 0)
+	trains, tests := rolling(data, 0)
+	assert.Equal(t, []int{2, 5, 7}, []int{trains[0].Len(), trains[1].Len(), trains[2].Len()})
+	assert.Equal(t, []int{3, 2, 3}, []int{tests[0].Len(), tests[1].Len(), tests[2].Len()})
+	for i := range trains {
+		maxTrain := int64(0)
+		for j := 0; j < trains[i].Len(); j++ {
+			if trains[i].GetTimestamp(j) > maxTrain {
+				maxTrain = trains[i].GetTimestamp(j)
+			}
+		}
+		for j := 0; j < tests[i].Len(); j++ {
+			assert.True(t, tests[i].GetTimestamp(j) > maxTrain)
+		}
+	}
+	// Sliding window
+	sliding := NewRollingOriginSplitter(3, 1)
+	trains, tests = sliding(data, 0)
+	assert.Equal(t, []int{2, 3, 2}, []int{trains[0].Len(), trains[1].Len(), trains[2].Len()})
+	assert.Equal(t, []int{3, 2, 3}, []int{tests[0].Len(), tests[1].Len(), tests[2].Len()})
+}
+
+func TestSplitter_Seed(t *testing.T) {
+	data := LoadDataFromBuiltIn("ml-100k")
+	indices := func(set DataSet) []int {
+		ids := make([]int, 0, set.Len())
+		set.ForEach(func(userId, itemId int, rating float64) {
+			ids = append(ids, userId*data.ItemCount()+itemId)
+		})
+		return ids
+	}
+	splitters := []Splitter{
+		NewKFoldSplitter(5),
+		NewRatioSplitter(2, 0.2),
+		NewUserLOOSplitter(2),
+		NewUserKeepNSplitter(2, 3, 0.2),
+	}
+	for _, splitter := range splitters {
+		trains1, tests1 := splitter(data, 1)
+		// The global random generator doesn't affect splitters
+		rand.Seed(2)
+		rand.Int()
+		trains2, tests2 := splitter(data, 1)
+		for i := range trains1 {
+			assert.Equal(t, indices(trains1[i]), indices(trains2[i]))
+			assert.Equal(t, indices(tests1[i]), indices(tests2[i]))
+		}
+	}
+	// Split
+	train1, test1 := Split(data, 0.2, 1)
+	rand.Seed(2)
+	train2, test2 := Split(data, 0.2, 1)
+	assert.Equal(t, indices(train1), indices(train2))
+	assert.Equal(t, indices(test1), indices(test2))
+}
+
+func TestColdUserSplitter(t *testing.T) {
+	data := LoadDataFromBuiltIn("ml-100k")
+	cold := NewColdUserSplitter(1, 0.2, 2)
+	trains, tests := cold(data, 0)
+	assert.Equal(t, data.Len(), trains[0].Len()+tests[0].Len())
+	assert.Equal(t, int(float64(data.UserCount())*0.2), tests[0].ColdUserIds.Len())
+	for _, userId := range tests[0].ColdUserIds.SparseIds {
+		denseUserId := trains[0].UserIdSet.ToDenseId(userId)
+		assert.Equal(t, 2, trains[0].DenseUserRatings[denseUserId].Len())
+	}
+	// Split warm ratings and cold ratings
+	warm, coldSet := tests[0].SplitCold()
+	assert.True(t, warm.Len() > 0)
+	assert.Equal(t, tests[0].Len(), warm.Len()+coldSet.Len())
+	assert.Equal(t, tests[0].ColdUserIds.Len(), coldSet.UserCount())
+	for i := 0; i < warm.Len(); i++ {
+		userId, itemId, _ := warm.Get(i)
+		assert.False(t, tests[0].IsCold(userId, itemId))
+	}
+}
+
+func TestColdUserSplitter_FewRatings(t *testing.T) {
+	// User 0 and user 1 have no more than k = 2 ratings
+	data := NewDataTable(
+		[]int{0, 1, 1, 2, 2, 2, 3, 3, 3},
+		[]int{0, 0, 1, 0, 1, 2, 0, 1, 2},
+		[]float64{1, 1, 1, 1, 1, 1, 1, 1, 1})
+	for seed := int64(0); seed < 10; seed++ {
+		trains, tests := NewColdUserSplitter(1, 1, 2)(data, seed)
+		assert.Equal(t, data.Len(), trains[0].Len()+tests[0].Len())
+		assert.Equal(t, 2, tests[0].ColdUserIds.Len())
+		assert.Equal(t, base.NotId, tests[0].ColdUserIds.ToDenseId(0))
+		assert.Equal(t, base.NotId, tests[0].ColdUserIds.ToDenseId(1))
+		// Each cold user has a rating in the test set
+		for _, userId := range tests[0].ColdUserIds.SparseIds {
+			assert.Equal(t, 1, tests[0].DenseUserRatings[tests[0].UserIdSet.ToDenseId(userId)].Len())
+		}
+	}
+}
+
+func TestColdItemSplitter(t *testing.T) {
+	data := LoadDataFromBuiltIn("ml-100k")
+	cold := NewColdItemSplitter(1, 0.2, 0)
+	trains, tests := cold(data, 0)
+	assert.Equal(t, data.Len(), trains[0].Len()+tests[0].Len())
+	assert.Equal(t, int(float64(data.ItemCount())*0.2), tests[0].ColdItemIds.Len())
+	// Cold items don't exist in the training set
+	for _, itemId := range tests[0].ColdItemIds.SparseIds {
+		assert.Equal(t, base.NotId, trains[0].ItemIdSet.ToDenseId(itemId))
+	}
+}
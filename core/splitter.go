@@ -1,6 +1,6 @@
 package core
 
-import "math/rand"
+import "sort"
 import "github.com/zhenghaoz/gorse/base"
 
 // Splitter split data to train set and test set.
@@ -13,8 +13,8 @@ func NewKFoldSplitter(k int) Splitter {
 		trainFolds := make([]DataSet, k)
 		testFolds := make([]DataSet, k)
 		// Generate permutation
-		rand.Seed(seed)
-		perm := rand.Perm(dataSet.Len())
+		rng := base.NewRandomGenerator(seed)
+		perm := rng.Perm(dataSet.Len())
 		// Split folds
 		foldSize := dataSet.Len() / k
 		begin, end := 0, 0
@@ -31,6 +31,7 @@ func NewKFoldSplitter(k int) Splitter {
 			trainFolds[i] = NewDataSet(dataSet.SubSet(trainIndex))
 			begin = end
 		}
+		inheritRawIds(dataSet, trainFolds, testFolds)
 		return trainFolds, testFolds
 	}
 }
@@ -41,9 +42,9 @@ func NewRatioSplitter(repeat int, testRatio float64) Splitter {
 		trainFolds := make([]DataSet, repeat)
 		testFolds := make([]DataSet, repeat)
 		testSize := int(float64(set.Len()) * testRatio)
-		rand.Seed(seed)
+		rng := base.NewRandomGenerator(seed)
 		for i := 0; i < repeat; i++ {
-			perm := rand.Perm(set.Len())
+			perm := rng.Perm(set.Len())
 			// Test Data
 			testIndex := perm[:testSize]
 			testFolds[i] = NewDataSet(set.SubSet(testIndex))
@@ -51,6 +52,7 @@ func NewRatioSplitter(repeat int, testRatio float64) Splitter {
 			trainIndex := perm[testSize:]
 			trainFolds[i] = NewDataSet(set.SubSet(trainIndex))
 		}
+		inheritRawIds(set, trainFolds, testFolds)
 		return trainFolds, testFolds
 	}
 }
@@ -60,36 +62,26 @@ func NewUserLOOSplitter(repeat int) Splitter {
 	return func(dataSet Table, seed int64) ([]DataSet, []DataSet) {
 		trainFolds := make([]DataSet, repeat)
 		testFolds := make([]DataSet, repeat)
-		rand.Seed(seed)
+		rng := base.NewRandomGenerator(seed)
 		trainSet := NewDataSet(dataSet)
+		userIndex := groupIndices(trainSet.DenseUserIds, trainSet.UserCount())
 		for i := 0; i < repeat; i++ {
-			trainUsers, trainItems, trainRatings :=
-				make([]int, 0, trainSet.Len()-trainSet.UserCount()),
-				make([]int, 0, trainSet.Len()-trainSet.UserCount()),
-				make([]float64, 0, trainSet.Len()-trainSet.UserCount())
-			testUsers, testItems, testRatings :=
-				make([]int, 0, trainSet.UserCount()),
-				make([]int, 0, trainSet.UserCount()),
-				make([]float64, 0, trainSet.UserCount())
-			for innerUserId, irs := range trainSet.DenseUserRatings {
-				userId := trainSet.UserIdSet.ToSparseId(innerUserId)
-				out := rand.Intn(irs.Len())
-				irs.ForEach(func(i, index int, value float64) {
-					itemId := trainSet.ItemIdSet.ToSparseId(index)
-					if i == out {
-						testUsers = append(testUsers, userId)
-						testItems = append(testItems, itemId)
-						testRatings = append(testRatings, value)
+			trainIndex := make([]int, 0, trainSet.Len()-trainSet.UserCount())
+			testIndex := make([]int, 0, trainSet.UserCount())
+			for _, indices := range userIndex {
+				out := rng.Intn(len(indices))
+				for j, index := range indices {
+					if j == out {
+						testIndex = append(testIndex, index)
 					} else {
-						trainUsers = append(trainUsers, userId)
-						trainItems = append(trainItems, itemId)
-						trainRatings = append(trainRatings, value)
+						trainIndex = append(trainIndex, index)
 					}
-				})
+				}
 			}
-			trainFolds[i] = NewDataSet(NewDataTable(trainUsers, trainItems, trainRatings))
-			testFolds[i] = NewDataSet(NewDataTable(testUsers, testItems, testRatings))
+			trainFolds[i] = NewDataSet(dataSet.SubSet(trainIndex))
+			testFolds[i] = NewDataSet(dataSet.SubSet(testIndex))
 		}
+		inheritRawIds(dataSet, trainFolds, testFolds)
 		return trainFolds, testFolds
 	}
 }
@@ -101,48 +93,241 @@ func NewUserKeepNSplitter(repeat int, n int, testRatio float64) Splitter {
 	return func(set Table, seed int64) ([]DataSet, []DataSet) {
 		trainFolds := make([]DataSet, repeat)
 		testFolds := make([]DataSet, repeat)
-		rand.Seed(seed)
+		rng := base.NewRandomGenerator(seed)
 		trainSet := NewDataSet(set)
+		userIndex := groupIndices(trainSet.DenseUserIds, trainSet.UserCount())
 		testSize := int(float64(trainSet.UserCount()) * testRatio)
 		for i := 0; i < repeat; i++ {
-			trainUsers, trainItems, trainRatings :=
-				make([]int, 0, trainSet.Len()-trainSet.UserCount()),
-				make([]int, 0, trainSet.Len()-trainSet.UserCount()),
-				make([]float64, 0, trainSet.Len()-trainSet.UserCount())
-			testUsers, testItems, testRatings :=
-				make([]int, 0, trainSet.UserCount()),
-				make([]int, 0, trainSet.UserCount()),
-				make([]float64, 0, trainSet.UserCount())
-			userPerm := rand.Perm(trainSet.UserCount())
+			trainIndex := make([]int, 0, trainSet.Len()-trainSet.UserCount())
+			testIndex := make([]int, 0, trainSet.UserCount())
+			userPerm := rng.Perm(trainSet.UserCount())
 			userTest := userPerm[:testSize]
 			userTrain := userPerm[testSize:]
-			userRatings := trainSet.DenseUserRatings
 			// Add all train user's ratings to train set
-			for _, userId := range userTrain {
-				userRatings[userId].ForEach(func(i, index int, value float64) {
-					trainUsers = append(trainUsers, userId)
-					trainItems = append(trainItems, index)
-					trainRatings = append(trainRatings, value)
-				})
+			for _, denseUserId := range userTrain {
+				trainIndex = append(trainIndex, userIndex[denseUserId]...)
 			}
 			// Add test user's ratings to train set and test set
-			for _, userId := range userTest {
-				ratingPerm := rand.Perm(userRatings[userId].Len())
+			for _, denseUserId := range userTest {
+				ratingPerm := rng.Perm(len(userIndex[denseUserId]))
 				for i, index := range ratingPerm {
 					if i < n {
-						trainUsers = append(trainUsers, userId)
-						trainItems = append(trainItems, userRatings[userId].Indices[index])
-						trainRatings = append(trainRatings, userRatings[userId].Values[index])
+						trainIndex = append(trainIndex, userIndex[denseUserId][index])
 					} else {
-						testUsers = append(testUsers, userId)
-						testItems = append(testItems, userRatings[userId].Indices[index])
-						testRatings = append(testRatings, userRatings[userId].Values[index])
+						testIndex = append(testIndex, userIndex[denseUserId][index])
 					}
 				}
 			}
-			trainFolds[i] = NewDataSet(NewDataTable(trainUsers, trainItems, trainRatings))
-			testFolds[i] = NewDataSet(NewDataTable(testUsers, testItems, testRatings))
+			trainFolds[i] = NewDataSet(set.SubSet(trainIndex))
+			testFolds[i] = NewDataSet(set.SubSet(testIndex))
+		}
+		inheritRawIds(set, trainFolds, testFolds)
+		return trainFolds, testFolds
+	}
+}
+
+// NewTimeCutoffSplitter creates a splitter by a global time cutoff. Ratings
+// before the cutoff are added to the training set and the rest are added to
+// the test set. Timestamps are required.
+func NewTimeCutoffSplitter(cutoff int64) Splitter {
+	return func(set Table, _ int64) ([]DataSet, []DataSet) {
+		requireTimestamp(set)
+		trainIndex := make([]int, 0, set.Len())
+		testIndex := make([]int, 0)
+		for i := 0; i < set.Len(); i++ {
+			if set.GetTimestamp(i) < cutoff {
+				trainIndex = append(trainIndex, i)
+			} else {
+				testIndex = append(testIndex, i)
+			}
+		}
+		trainFolds := []DataSet{NewDataSet(set.SubSet(trainIndex))}
+		testFolds := []DataSet{NewDataSet(set.SubSet(testIndex))}
+		inheritRawIds(set, trainFolds, testFolds)
+		return trainFolds, testFolds
+	}
+}
+
+// NewUserLastNSplitter creates a per-user splitter which holds out the last n
+// ratings of each user by timestamps. At least one rating of each user is kept
+// in the training set. Timestamps are required.
+func NewUserLastNSplitter(n int) Splitter {
+	return func(set Table, _ int64) ([]DataSet, []DataSet) {
+		requireTimestamp(set)
+		trainSet := NewDataSet(set)
+		trainIndex := make([]int, 0, trainSet.Len())
+		testIndex := make([]int, 0, trainSet.UserCount()*n)
+		for _, indices := range groupIndices(trainSet.DenseUserIds, trainSet.UserCount()) {
+			sortByTime(set, indices)
+			nTest := n
+			if nTest > len(indices)-1 {
+				nTest = len(indices) - 1
+			}
+			trainIndex = append(trainIndex, indices[:len(indices)-nTest]...)
+			testIndex = append(testIndex, indices[len(indices)-nTest:]...)
+		}
+		trainFolds := []DataSet{NewDataSet(set.SubSet(trainIndex))}
+		testFolds := []DataSet{NewDataSet(set.SubSet(testIndex))}
+		inheritRawIds(set, trainFolds, testFolds)
+		return trainFolds, testFolds
+	}
+}
+
+// NewRollingOriginSplitter creates a rolling-origin splitter. Ratings are sorted
+// by timestamps and divided into k+1 consecutive blocks of similar sizes, where
+// ratings with the same timestamp are in the same block. The i-th test set is
+// the (i+1)-th block and the i-th training set consists of blocks before it:
+//   window = 0	- all blocks before it (expanding window)
+//   window > 0	- at most window blocks before it (sliding window)
+// Timestamps are required.
+func NewRollingOriginSplitter(k int, window int) Splitter {
+	return func(set Table, _ int64) ([]DataSet, []DataSet) {
+		requireTimestamp(set)
+		trainFolds := make([]DataSet, k)
+		testFolds := make([]DataSet, k)
+		// Sort ratings by timestamps
+		order := make([]int, set.Len())
+		for i := range order {
+			order[i] = i
+		}
+		sortByTime(set, order)
+		// Find bounds of blocks
+		bounds := make([]int, k+2)
+		for i := 1; i <= k+1; i++ {
+			bounds[i] = i * set.Len() / (k + 1)
+			if bounds[i] < bounds[i-1] {
+				bounds[i] = bounds[i-1]
+			}
+			for bounds[i] > 0 && bounds[i] < set.Len() &&
+				set.GetTimestamp(order[bounds[i]]) == set.GetTimestamp(order[bounds[i]-1]) {
+				bounds[i]++
+			}
+		}
+		// Split folds
+		for i := 0; i < k; i++ {
+			begin := 0
+			if window > 0 && i+1 > window {
+				begin = i + 1 - window
+			}
+			trainFolds[i] = NewDataSet(set.SubSet(order[bounds[begin]:bounds[i+1]]))
+			testFolds[i] = NewDataSet(set.SubSet(order[bounds[i+1]:bounds[i+2]]))
+		}
+		inheritRawIds(set, trainFolds, testFolds)
+		return trainFolds, testFolds
+	}
+}
+
+// requireTimestamp panics if timestamps are not available.
+func requireTimestamp(set Table) {
+	if !set.HasTimestamp() {
+		panic("Timestamps are required by temporal splitters")
+	}
+}
+
+// sortByTime sorts indices of ratings by timestamps. The order of ratings with
+// the same timestamp is kept.
+func sortByTime(set Table, indices []int) {
+	sort.SliceStable(indices, func(i, j int) bool {
+		return set.GetTimestamp(indices[i]) < set.GetTimestamp(indices[j])
+	})
+}
+
+// NewColdUserSplitter creates a cold-start splitter for users. A testRatio
+// fraction of users are picked as cold users. k random ratings of each cold
+// user are added to the training set as warm-up (k = 0 means strict cold-start)
+// and the rest are added to the test set. Users with k ratings or fewer are
+// never picked as cold users, since no rating would be left to test. Besides, a testRatio fraction of
+// ratings of each warm user are held out to the test set to measure the warm
+// performance. Cold users are recorded in ColdUserIds of test sets.
+func NewColdUserSplitter(repeat int, testRatio float64, k int) Splitter {
+	return func(set Table, seed int64) ([]DataSet, []DataSet) {
+		trainSet := NewDataSet(set)
+		groups := groupIndices(trainSet.DenseUserIds, trainSet.UserCount())
+		trainFolds, testFolds, coldIds := coldStartSplit(set, groups, &trainSet.UserIdSet, repeat, testRatio, k, seed)
+		for i := range testFolds {
+			testFolds[i].ColdUserIds = coldIds[i]
 		}
 		return trainFolds, testFolds
 	}
 }
+
+// NewColdItemSplitter creates a cold-start splitter for items. It's same as
+// NewColdUserSplitter except that items are split instead of users. Cold
+// items are recorded in ColdItemIds of test sets.
+func NewColdItemSplitter(repeat int, testRatio float64, k int) Splitter {
+	return func(set Table, seed int64) ([]DataSet, []DataSet) {
+		trainSet := NewDataSet(set)
+		groups := groupIndices(trainSet.DenseItemIds, trainSet.ItemCount())
+		trainFolds, testFolds, coldIds := coldStartSplit(set, groups, &trainSet.ItemIdSet, repeat, testRatio, k, seed)
+		for i := range testFolds {
+			testFolds[i].ColdItemIds = coldIds[i]
+		}
+		return trainFolds, testFolds
+	}
+}
+
+// coldStartSplit splits groups of ratings into cold groups and warm groups.
+// Only groups with more than k ratings could be cold groups.
+// Sparse IDs of cold groups are returned as well.
+func coldStartSplit(set Table, groups [][]int, idSet *base.SparseIdSet, repeat int, testRatio float64, k int,
+	seed int64) ([]DataSet, []DataSet, []base.SparseIdSet) {
+	trainFolds := make([]DataSet, repeat)
+	testFolds := make([]DataSet, repeat)
+	coldIds := make([]base.SparseIdSet, repeat)
+	rng := base.NewRandomGenerator(seed)
+	coldSize := int(float64(len(groups)) * testRatio)
+	for i := 0; i < repeat; i++ {
+		trainIndex := make([]int, 0, set.Len())
+		testIndex := make([]int, 0)
+		coldIds[i] = base.MakeSparseIdSet()
+		groupPerm := rng.Perm(len(groups))
+		for _, denseId := range groupPerm {
+			// Keep k ratings of cold groups and hold out a ratio of ratings of warm groups
+			group := groups[denseId]
+			nTrain := len(group) - int(float64(len(group))*testRatio)
+			if coldIds[i].Len() < coldSize && len(group) > k {
+				coldIds[i].Add(idSet.ToSparseId(denseId))
+				nTrain = k
+			}
+			for l, index := range rng.Perm(len(group)) {
+				if l < nTrain {
+					trainIndex = append(trainIndex, group[index])
+				} else {
+					testIndex = append(testIndex, group[index])
+				}
+			}
+		}
+		trainFolds[i] = NewDataSet(set.SubSet(trainIndex))
+		testFolds[i] = NewDataSet(set.SubSet(testIndex))
+	}
+	inheritRawIds(set, trainFolds, testFolds)
+	return trainFolds, testFolds, coldIds
+}
+
+// groupIndices groups indices of ratings by dense IDs.
+func groupIndices(denseIds []int, count int) [][]int {
+	indices := make([][]int, count)
+	for i, denseId := range denseIds {
+		indices[denseId] = append(indices[denseId], i)
+	}
+	return indices
+}
+
+// inheritRawIds attaches raw ID sets of the source data set to folds.
+func inheritRawIds(source Table, folds ...[]DataSet) {
+	var userRawIds, itemRawIds *base.StringIdSet
+	switch set := source.(type) {
+	case DataSet:
+		userRawIds, itemRawIds = set.UserRawIds, set.ItemRawIds
+	case *DataSet:
+		userRawIds, itemRawIds = set.UserRawIds, set.ItemRawIds
+	default:
+		return
+	}
+	for _, fold := range folds {
+		for i := range fold {
+			fold[i].UserRawIds = userRawIds
+			fold[i].ItemRawIds = itemRawIds
+		}
+	}
+}
@@ -8,11 +8,12 @@ import (
 
 /* Table */
 
-// DataTable is an array of (userId, itemId, rating).
+// DataTable is an array of (userId, itemId, rating) with optional timestamps.
 type DataTable struct {
-	Ratings []float64
-	Users   []int
-	Items   []int
+	Ratings    []float64
+	Users      []int
+	Items      []int
+	Timestamps []int64 // Unix timestamps, nil if not available
 }
 
 // NewDataTable creates a new raw data set.
@@ -24,6 +25,16 @@ func NewDataTable(users, items []int, ratings []float64) *DataTable {
 	}
 }
 
+// NewTimedDataTable creates a new raw data set with timestamps.
+func NewTimedDataTable(users, items []int, ratings []float64, timestamps []int64) *DataTable {
+	return &DataTable{
+		Users:      users,
+		Items:      items,
+		Ratings:    ratings,
+		Timestamps: timestamps,
+	}
+}
+
 func (dataSet *DataTable) Len() int {
 	return len(dataSet.Ratings)
 }
@@ -32,6 +43,17 @@ func (dataSet *DataTable) Get(i int) (int, int, float64) {
 	return dataSet.Users[i], dataSet.Items[i], dataSet.Ratings[i]
 }
 
+func (dataSet *DataTable) HasTimestamp() bool {
+	return dataSet.Timestamps != nil
+}
+
+func (dataSet *DataTable) GetTimestamp(i int) int64 {
+	if dataSet.Timestamps == nil {
+		return 0
+	}
+	return dataSet.Timestamps[i]
+}
+
 func (dataSet *DataTable) ForEach(f func(userId, itemId int, rating float64)) {
 	for i := 0; i < dataSet.Len(); i++ {
 		f(dataSet.Users[i], dataSet.Items[i], dataSet.Ratings[i])
@@ -87,6 +109,14 @@ func (dataSet *VirtualTable) Get(i int) (int, int, float64) {
 	return dataSet.data.Get(indexInData)
 }
 
+func (dataSet *VirtualTable) HasTimestamp() bool {
+	return dataSet.data.HasTimestamp()
+}
+
+func (dataSet *VirtualTable) GetTimestamp(i int) int64 {
+	return dataSet.data.GetTimestamp(dataSet.index[i])
+}
+
 func (dataSet *VirtualTable) ForEach(f func(userId, itemId int, rating float64)) {
 	for i := 0; i < dataSet.Len(); i++ {
 		userId, itemId, rating := dataSet.Get(i)
@@ -2,60 +2,42 @@ package core
 
 import (
 	"github.com/zhenghaoz/gorse/base"
-	"gonum.org/v1/gonum/floats"
-	"math/rand"
 )
 
-func GetRelevantSet(test DataSet, denseUserId int) map[int]float64 {
-	set := make(map[int]float64)
-	test.DenseUserRatings[denseUserId].ForEach(func(i, index int, value float64) {
-		itemId := test.ItemIdSet.ToSparseId(index)
-		set[itemId] = value
-	})
-	return set
+// GetRelevantSet finds relevant items of a user in the test set. All items
+// rated by the user are relevant unless WithRelevanceThreshold is given.
+func GetRelevantSet(test DataSet, denseUserId int, option ...EvaluatorOption) map[int]float64 {
+	return NewEvaluatorOptions(true, option).relevantSet(test, denseUserId)
 }
 
-// Top gets the ranking
+// Top gets the ranking of items in the test set for a user, where items
+// rated in the training set are excluded. Items are ranked by Recommend if the
+// model is a Recommender.
 func Top(test DataSet, denseUserId int, n int, train DataSet, model Model) []int {
-	// Find ratings in training set
-	trainSet := make(map[int]float64)
 	userId := test.UserIdSet.ToSparseId(denseUserId)
-	denseUserIdInTrain := train.UserIdSet.ToDenseId(userId)
-	if denseUserIdInTrain != base.NotId {
-		train.DenseUserRatings[denseUserIdInTrain].ForEach(func(i, index int, value float64) {
-			itemId := train.ItemIdSet.ToSparseId(index)
-			trainSet[itemId] = value
-		})
-	}
-	// Get top-n list
-	list := make([]int, 0)
-	ids := make([]int, 0)
-	indices := make([]int, 0)
-	ratings := make([]float64, 0)
-	for i := 0; i < test.ItemCount(); i++ {
-		itemId := test.ItemIdSet.ToSparseId(i)
-		if _, exist := trainSet[itemId]; !exist {
-			indices = append(indices, i)
-			ids = append(ids, itemId)
-			ratings = append(ratings, -model.Predict(userId, itemId))
-		}
-	}
-	floats.Argsort(ratings, indices)
-	for i := 0; i < n && i < len(indices); i++ {
-		index := indices[i]
-		list = append(list, ids[index])
+	options := []RecommendOption{WithCandidates(test.ItemIdSet.SparseIds), WithExcludeRated(train)}
+	if recommender, ok := model.(Recommender); ok {
+		list, _ := recommender.Recommend(userId, n, options...)
+		return list
 	}
+	list, _ := RecommendByPredict(model, userId, n, nil, options...)
 	return list
 }
 
-func Split(data DataSet, testRatio float64) (train, test DataSet) {
+// Split splits a data set to a training set and a test set. The same seed
+// always results in the same split.
+func Split(data DataSet, testRatio float64, seed int64) (train, test DataSet) {
 	testSize := int(float64(data.Len()) * testRatio)
-	perm := rand.Perm(data.Len())
+	rng := base.NewRandomGenerator(seed)
+	perm := rng.Perm(data.Len())
 	// Test Data
 	testIndex := perm[:testSize]
 	test = NewDataSet(data.SubSet(testIndex))
 	// Train Data
 	trainIndex := perm[testSize:]
 	train = NewDataSet(data.SubSet(trainIndex))
+	// Raw IDs
+	train.UserRawIds, train.ItemRawIds = data.UserRawIds, data.ItemRawIds
+	test.UserRawIds, test.ItemRawIds = data.UserRawIds, data.ItemRawIds
 	return
 }
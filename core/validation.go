@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"github.com/zhenghaoz/gorse/base"
 	"gonum.org/v1/gonum/stat"
@@ -14,9 +15,13 @@ type ParameterGrid map[base.ParamName][]interface{}
 
 /* Cross Validation */
 
-// CrossValidateResult contains the result of cross validate
+// CrossValidateResult contains the result of cross validate. If test folds
+// contain cold users or items, scores on warm ratings and cold ratings are
+// reported separately as well.
 type CrossValidateResult struct {
 	TestScore []float64
+	WarmScore []float64 // Scores on warm ratings, nil if there are no cold users or items
+	ColdScore []float64 // Scores on cold ratings, nil if there are no cold users or items
 	TestTime  []float64
 	FitTime   []float64
 }
@@ -33,20 +38,57 @@ func (sv CrossValidateResult) MeanMarginScore() (float64, float64) {
 	return mean, margin
 }
 
+// FitContext fits a model with a context. Iterative models stop fitting
+// between epochs if the context is canceled, where the partially fitted model
+// is kept and ctx.Err() is returned. The model isn't fitted if the context is
+// canceled before fitting. Nil is returned if fitting is completed, even if
+// the context is canceled after the last epoch.
+func FitContext(ctx context.Context, estimator Model, trainSet DataSet, options ...base.FitOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var fitOptions *base.FitOptions
+	estimator.Fit(trainSet, append(options, base.WithContext(ctx), func(options *base.FitOptions) {
+		fitOptions = options
+	})...)
+	if fitOptions != nil && fitOptions.Interrupted {
+		return ctx.Err()
+	}
+	return nil
+}
+
 // CrossValidation evaluates a model by k-fold cross validation.
 func CrossValidate(estimator Model, dataSet Table, metrics []Evaluator,
 	splitter Splitter, options ...base.CVOption) []CrossValidateResult {
+	ret, _ := CrossValidateContext(context.Background(), estimator, dataSet, metrics, splitter, options...)
+	return ret
+}
+
+// CrossValidateContext evaluates a model by k-fold cross validation with a
+// context. If the context is canceled before all folds are completed, remaining
+// folds are skipped and results of completed folds are returned with ctx.Err().
+func CrossValidateContext(ctx context.Context, estimator Model, dataSet Table, metrics []Evaluator,
+	splitter Splitter, options ...base.CVOption) ([]CrossValidateResult, error) {
 	cvOptions := base.NewCVOptions(options)
 	// Split data set
 	trainFolds, testFolds := splitter(dataSet, cvOptions.Seed)
 	length := len(trainFolds)
 	// Create return structures
 	ret := make([]CrossValidateResult, len(metrics))
+	hasCold := false
+	for _, testFold := range testFolds {
+		hasCold = hasCold || testFold.HasCold()
+	}
 	for i := 0; i < len(ret); i++ {
 		ret[i].TestScore = make([]float64, length)
+		if hasCold {
+			ret[i].WarmScore = make([]float64, length)
+			ret[i].ColdScore = make([]float64, length)
+		}
 	}
 	// Cross validation
 	params := estimator.GetParams()
+	completed := make([]bool, length)
 	base.Parallel(length, cvOptions.NJobs, func(begin, end int) {
 		cp := reflect.New(reflect.TypeOf(estimator).Elem()).Interface().(Model)
 		Copy(cp, estimator)
@@ -54,14 +96,111 @@ func CrossValidate(estimator Model, dataSet Table, metrics []Evaluator,
 			trainFold := trainFolds[i]
 			testFold := testFolds[i]
 			cp.SetParams(params)
-			cp.Fit(trainFold)
+			if FitContext(ctx, cp, trainFold) != nil {
+				return
+			}
 			// Evaluate on test set
 			for j := 0; j < len(ret); j++ {
 				ret[j].TestScore[i] = metrics[j](cp, testFold, WithTrainSet(trainFold))
 			}
+			// Evaluate on warm ratings and cold ratings
+			if hasCold {
+				warmFold, coldFold := testFold.SplitCold()
+				for j := 0; j < len(ret); j++ {
+					ret[j].WarmScore[i] = metrics[j](cp, warmFold, WithTrainSet(trainFold))
+					ret[j].ColdScore[i] = metrics[j](cp, coldFold, WithTrainSet(trainFold))
+				}
+			}
+			completed[i] = true
 		}
 	})
-	return ret
+	for _, done := range completed {
+		if !done {
+			for i := range ret {
+				ret[i] = ret[i].subset(completed)
+			}
+			return ret, ctx.Err()
+		}
+	}
+	return ret, nil
+}
+
+// subset returns scores of completed folds.
+func (sv CrossValidateResult) subset(completed []bool) CrossValidateResult {
+	filter := func(scores []float64) []float64 {
+		if scores == nil {
+			return nil
+		}
+		ret := make([]float64, 0, len(scores))
+		for i := range scores {
+			if completed[i] {
+				ret = append(ret, scores[i])
+			}
+		}
+		return ret
+	}
+	return CrossValidateResult{
+		TestScore: filter(sv.TestScore),
+		WarmScore: filter(sv.WarmScore),
+		ColdScore: filter(sv.ColdScore),
+		TestTime:  filter(sv.TestTime),
+		FitTime:   filter(sv.FitTime),
+	}
+}
+
+/* Early Stopping */
+
+// WithEarlyStopping evaluates a model on the validation set after each epoch
+// and stops fitting if the score hasn't been improved for patience epochs.
+// Parameters with the best score are kept. As in GridSearchCV, lower scores
+// are better, so ranking metrics should be negated. Options are passed to the
+// evaluator, e.g. WithTrainSet for ranking metrics. It's supported by SVD,
+// SVDpp, NMF, WRMF, BaseLine and CoClustering.
+func WithEarlyStopping(validSet DataSet, evaluator Evaluator, patience int, option ...EvaluatorOption) base.FitOption {
+	return func(options *base.FitOptions) {
+		// Create a new stopper for each fitting
+		options.EarlyStopper = &earlyStopper{
+			validSet:  validSet,
+			evaluator: evaluator,
+			option:    option,
+			patience:  patience,
+			bestScore: math.Inf(1),
+		}
+	}
+}
+
+// earlyStopper keeps a copy of the model with the best validation score.
+type earlyStopper struct {
+	validSet  DataSet
+	evaluator Evaluator
+	option    []EvaluatorOption
+	patience  int
+	bestScore float64
+	bestEpoch int
+	bestModel Model
+}
+
+// Stop evaluates the model and returns true if the score hasn't been improved
+// for patience epochs.
+func (stopper *earlyStopper) Stop(model interface{}, epoch int) bool {
+	estimator := model.(Model)
+	score := stopper.evaluator(estimator, stopper.validSet, stopper.option...)
+	if score < stopper.bestScore {
+		stopper.bestScore = score
+		stopper.bestEpoch = epoch
+		stopper.bestModel = reflect.New(reflect.TypeOf(estimator).Elem()).Interface().(Model)
+		if err := Copy(stopper.bestModel, estimator); err != nil {
+			panic(err)
+		}
+	}
+	return epoch-stopper.bestEpoch >= stopper.patience
+}
+
+// Restore copies parameters of the best model to the model.
+func (stopper *earlyStopper) Restore(model interface{}) {
+	if stopper.bestModel != nil {
+		CopyParams(model, stopper.bestModel)
+	}
 }
 
 /* Model Selection */
@@ -83,6 +222,15 @@ func (cv ModelSelectionResult) Summary() {
 // GridSearchCV finds the best parameters for a model.
 func GridSearchCV(estimator Model, dataSet Table,
 	evaluators []Evaluator, splitter Splitter, paramGrid ParameterGrid, options ...base.CVOption) []ModelSelectionResult {
+	results, _ := GridSearchCVContext(context.Background(), estimator, dataSet, evaluators, splitter, paramGrid, options...)
+	return results
+}
+
+// GridSearchCVContext finds the best parameters for a model with a context. If
+// the context is canceled, results of completed parameters are returned with
+// ctx.Err().
+func GridSearchCVContext(ctx context.Context, estimator Model, dataSet Table,
+	evaluators []Evaluator, splitter Splitter, paramGrid ParameterGrid, options ...base.CVOption) ([]ModelSelectionResult, error) {
 	// Retrieve parameter names and length
 	paramNames := make([]base.ParamName, 0, len(paramGrid))
 	count := 1
@@ -103,10 +251,16 @@ func GridSearchCV(estimator Model, dataSet Table,
 	// Construct DFS procedure
 	var dfs func(deep int, params base.Params)
 	dfs = func(deep int, params base.Params) {
+		if ctx.Err() != nil {
+			return
+		}
 		if deep == len(paramNames) {
 			// Cross validate
 			estimator.SetParams(params)
-			cvResults := CrossValidate(estimator, dataSet, evaluators, splitter, options...)
+			cvResults, err := CrossValidateContext(ctx, estimator, dataSet, evaluators, splitter, options...)
+			if err != nil {
+				return
+			}
 			for i := range cvResults {
 				results[i].CVResults = append(results[i].CVResults, cvResults[i])
 				results[i].AllParams = append(results[i].AllParams, params.Copy())
@@ -130,12 +284,26 @@ func GridSearchCV(estimator Model, dataSet Table,
 	}
 	params := make(map[base.ParamName]interface{})
 	dfs(0, params)
+	if err := ctx.Err(); err != nil {
+		bar.FinishPrint("Canceled!")
+		return results, err
+	}
 	bar.FinishPrint("Completed!")
-	return results
+	return results, nil
 }
 
+// RandomSearchCV finds the best parameters for a model from random trials.
 func RandomSearchCV(estimator Model, dataSet Table, paramGrid ParameterGrid,
 	evaluators []Evaluator, trial int, options ...base.CVOption) []ModelSelectionResult {
+	results, _ := RandomSearchCVContext(context.Background(), estimator, dataSet, paramGrid, evaluators, trial, options...)
+	return results
+}
+
+// RandomSearchCVContext finds the best parameters for a model from random
+// trials with a context. If the context is canceled, results of completed
+// trials are returned with ctx.Err().
+func RandomSearchCVContext(ctx context.Context, estimator Model, dataSet Table, paramGrid ParameterGrid,
+	evaluators []Evaluator, trial int, options ...base.CVOption) ([]ModelSelectionResult, error) {
 	cvOptions := base.NewCVOptions(options)
 	rng := base.NewRandomGenerator(cvOptions.Seed)
 	// Create results
@@ -155,7 +323,11 @@ func RandomSearchCV(estimator Model, dataSet Table, paramGrid ParameterGrid,
 			params[paramName] = value
 		}
 		// Cross validate
-		cvResults := CrossValidate(estimator, dataSet, evaluators, NewKFoldSplitter(5), options...)
+		estimator.SetParams(params)
+		cvResults, err := CrossValidateContext(ctx, estimator, dataSet, evaluators, NewKFoldSplitter(5), options...)
+		if err != nil {
+			return results, err
+		}
 		for i := range cvResults {
 			results[i].CVResults = append(results[i].CVResults, cvResults[i])
 			results[i].AllParams = append(results[i].AllParams, params.Copy())
@@ -167,5 +339,5 @@ func RandomSearchCV(estimator Model, dataSet Table, paramGrid ParameterGrid,
 			}
 		}
 	}
-	return results
+	return results, nil
 }
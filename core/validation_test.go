@@ -1,13 +1,82 @@
 package core
 
 import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	. "github.com/zhenghaoz/gorse/base"
+	"gonum.org/v1/gonum/stat"
+	"math"
 	"testing"
 )
 
 // TODO: Add tests
 
-func TestCrossValidate(t *testing.T) {
+// CVTesterModel predicts the mean rating of a user, or the global mean if the
+// user doesn't exist.
+type CVTesterModel struct {
+	GlobalMean float64
+	UserMeans  map[int]float64
+}
+
+func (tester *CVTesterModel) GetParams() Params {
+	return Params{}
+}
+
+func (tester *CVTesterModel) SetParams(params Params) {}
+
+func (tester *CVTesterModel) Predict(userId, itemId int) float64 {
+	if mean, exist := tester.UserMeans[userId]; exist {
+		return mean
+	}
+	return tester.GlobalMean
+}
+
+func (tester *CVTesterModel) Fit(set DataSet, options ...FitOption) {
+	tester.GlobalMean = set.GlobalMean
+	tester.UserMeans = make(map[int]float64)
+	for denseUserId, ratings := range set.DenseUserRatings {
+		if ratings.Len() > 0 {
+			tester.UserMeans[set.UserIdSet.ToSparseId(denseUserId)] = stat.Mean(ratings.Values, nil)
+		}
+	}
+}
+
+// ParamsTesterModel predicts the learning rate as ratings.
+type ParamsTesterModel struct {
+	Rating float64
+}
+
+func (tester *ParamsTesterModel) GetParams() Params {
+	return Params{Lr: tester.Rating}
+}
+
+func (tester *ParamsTesterModel) SetParams(params Params) {
+	tester.Rating = params.GetFloat64(Lr, 0)
+}
+
+func (tester *ParamsTesterModel) Predict(userId, itemId int) float64 {
+	return tester.Rating
+}
+
+func (tester *ParamsTesterModel) Fit(set DataSet, options ...FitOption) {}
 
+func TestCrossValidate(t *testing.T) {
+	data := LoadDataFromBuiltIn("ml-100k")
+	// Without cold users
+	out := CrossValidate(&CVTesterModel{}, data, []Evaluator{RMSE}, NewKFoldSplitter(2))
+	assert.Equal(t, 2, len(out[0].TestScore))
+	assert.Nil(t, out[0].WarmScore)
+	assert.Nil(t, out[0].ColdScore)
+	// With cold users
+	out = CrossValidate(&CVTesterModel{}, data, []Evaluator{RMSE}, NewColdUserSplitter(2, 0.2, 0))
+	assert.Equal(t, 2, len(out[0].WarmScore))
+	assert.Equal(t, 2, len(out[0].ColdScore))
+	for i := range out[0].TestScore {
+		// The overall RMSE lies between RMSEs of two parts
+		low := math.Min(out[0].WarmScore[i], out[0].ColdScore[i])
+		high := math.Max(out[0].WarmScore[i], out[0].ColdScore[i])
+		assert.True(t, low <= out[0].TestScore[i] && out[0].TestScore[i] <= high)
+	}
 }
 
 func TestGridSearchCV(t *testing.T) {
@@ -31,5 +100,81 @@ func TestGridSearchCV(t *testing.T) {
 }
 
 func TestRandomSearchCV(t *testing.T) {
+	data := LoadDataFromBuiltIn("ml-100k")
+	sequential := func(options *CVOptions) { options.NJobs = 1 }
+	grid := ParameterGrid{Lr: {0.0, 3.0}}
+	out := RandomSearchCV(&ParamsTesterModel{}, data, grid, []Evaluator{RMSE}, 4, sequential)
+	// Models are fitted with parameters of trials
+	for i, params := range out[0].AllParams {
+		score := stat.Mean(out[0].CVResults[i].TestScore, nil)
+		assert.Equal(t, params.GetFloat64(Lr, 0) == 3.0, score < 2)
+	}
+}
+
+func TestWithEarlyStopping(t *testing.T) {
+	data := NewDataSet(NewDataTable([]int{0, 1}, []int{0, 0}, []float64{1, 3}))
+	// Scores decrease until the 3rd epoch
+	scores := []float64{3, 2, 1, 2, 1, 4}
+	evaluator := func(model Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		return scores[int(model.(*CVTesterModel).GlobalMean)-1]
+	}
+	options := NewFitOptions([]FitOption{WithEarlyStopping(data, evaluator, 3)})
+	model := &CVTesterModel{UserMeans: map[int]float64{0: 1}}
+	stopped := 0
+	for epoch := 1; epoch <= len(scores) && stopped == 0; epoch++ {
+		model.GlobalMean = float64(epoch)
+		if options.EarlyStopper.Stop(model, epoch) {
+			stopped = epoch
+		}
+	}
+	assert.Equal(t, 6, stopped)
+	// Parameters of the best epoch are restored
+	model.UserMeans = nil
+	options.EarlyStopper.Restore(model)
+	assert.Equal(t, 3.0, model.GlobalMean)
+	assert.Equal(t, map[int]float64{0: 1}, model.UserMeans)
+}
+
+func TestCrossValidateContext(t *testing.T) {
+	data := LoadDataFromBuiltIn("ml-100k")
+	sequential := func(options *CVOptions) { options.NJobs = 1 }
+	// Cancel after the first fold
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelRMSE := func(estimator Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		defer cancel()
+		return RMSE(estimator, testSet, option...)
+	}
+	out, err := CrossValidateContext(ctx, &CVTesterModel{}, data, []Evaluator{cancelRMSE}, NewKFoldSplitter(3), sequential)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, len(out[0].TestScore))
+	// Canceled before fitting
+	out, err = CrossValidateContext(ctx, &CVTesterModel{}, data, []Evaluator{RMSE}, NewKFoldSplitter(3))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, len(out[0].TestScore))
+	// Fit with a canceled context
+	assert.Equal(t, context.Canceled, FitContext(ctx, &CVTesterModel{}, data))
+	assert.Nil(t, FitContext(context.Background(), &CVTesterModel{}, data))
+}
 
+func TestGridSearchCVContext(t *testing.T) {
+	data := LoadDataFromBuiltIn("ml-100k")
+	sequential := func(options *CVOptions) { options.NJobs = 1 }
+	// Cancel after the first parameters
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	cancelRMSE := func(estimator Model, testSet DataSet, option ...EvaluatorOption) float64 {
+		if count++; count == 2 {
+			cancel()
+		}
+		return RMSE(estimator, testSet, option...)
+	}
+	grid := ParameterGrid{NEpochs: {1, 2, 3}}
+	out, err := GridSearchCVContext(ctx, &CVTesterModel{}, data, []Evaluator{cancelRMSE}, NewKFoldSplitter(2), grid, sequential)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, len(out[0].CVResults))
+	assert.Equal(t, 0, out[0].BestIndex)
+	// Random search
+	out, err = RandomSearchCVContext(ctx, &CVTesterModel{}, data, grid, []Evaluator{RMSE}, 3, sequential)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, len(out[0].CVResults))
 }
@@ -11,7 +11,7 @@ func main() {
 	// Load dataset
 	data := core.LoadDataFromBuiltIn("ml-100k")
 	// Split dataset
-	train, test := core.Split(data, 0.2)
+	train, test := core.Split(data, 0.2, 0)
 	// Create model
 	svd := model.NewSVD(base.Params{
 		base.Lr:       0.007,
@@ -2,6 +2,12 @@ package model
 
 import "github.com/zhenghaoz/gorse/core"
 import "github.com/zhenghaoz/gorse/base"
+import "fmt"
+import "gonum.org/v1/gonum/floats"
+import "gonum.org/v1/gonum/mat"
+import "log"
+import "sync"
+import "time"
 
 /* Base Model */
 
@@ -10,9 +16,15 @@ type BaseModel struct {
 	Params          base.Params          // Hyper-parameters
 	UserIdSet       base.SparseIdSet     // Users' ID set
 	ItemIdSet       base.SparseIdSet     // Items' ID set
+	UserRawIds      *base.StringIdSet    // Users' raw ID set
+	ItemRawIds      *base.StringIdSet    // Items' raw ID set
 	rng             base.RandomGenerator // Random generator
 	randState       int64                // Random seed
 	rtOptions       *base.FitOptions     // Runtime options
+	fitStart        time.Time            // Time when fitting started
+	updaters        *updaters            // Optimizers of SGD-based models, nil for others
+	itemMatrix      *mat.Dense           // Cached item factors for batch scoring
+	itemMatrixLock  sync.Mutex
 	getParamsCalled bool
 }
 
@@ -26,6 +38,26 @@ func (model *BaseModel) GetParams() base.Params {
 	return model.Params
 }
 
+// UserId converts a raw user ID to the user ID. NotId is returned if the raw ID doesn't exist.
+func (model *BaseModel) UserId(rawUserId string) int {
+	return model.UserRawIds.ToSparseId(rawUserId)
+}
+
+// ItemId converts a raw item ID to the item ID. NotId is returned if the raw ID doesn't exist.
+func (model *BaseModel) ItemId(rawItemId string) int {
+	return model.ItemRawIds.ToSparseId(rawItemId)
+}
+
+// RawUserId converts a user ID to the raw user ID. An empty string is returned if the ID doesn't exist.
+func (model *BaseModel) RawUserId(userId int) string {
+	return model.UserRawIds.ToStringId(userId)
+}
+
+// RawItemId converts a item ID to the raw item ID. An empty string is returned if the ID doesn't exist.
+func (model *BaseModel) RawItemId(itemId int) string {
+	return model.ItemRawIds.ToStringId(itemId)
+}
+
 func (model *BaseModel) Predict(userId, itemId int) float64 {
 	panic("Predict() not implemented")
 }
@@ -43,10 +75,306 @@ func (model *BaseModel) Init(trainSet core.DataSet, options []base.FitOption) {
 	// Setup ID set
 	model.UserIdSet = trainSet.UserIdSet
 	model.ItemIdSet = trainSet.ItemIdSet
+	model.UserRawIds = trainSet.UserRawIds
+	model.ItemRawIds = trainSet.ItemRawIds
 	// Setup random state
 	model.rng = base.NewRandomGenerator(model.randState)
 	// Setup runtime options
 	model.rtOptions = base.NewFitOptions(options)
+	model.fitStart = time.Now()
+	model.resetItemMatrix()
+}
+
+// epochEnd is called by iterative models after the epoch-th epoch with the
+// training loss. Callbacks are called and true is returned if fitting should
+// be stopped by the early stopper.
+func (model *BaseModel) epochEnd(self core.Model, epoch int, loss float64) bool {
+	model.resetItemMatrix()
+	elapsed := time.Since(model.fitStart)
+	for _, callback := range model.rtOptions.Callbacks {
+		callback(epoch, loss, elapsed)
+	}
+	// Save checkpoint
+	if model.rtOptions.CheckpointFile != "" && model.rtOptions.CheckpointEvery > 0 &&
+		epoch%model.rtOptions.CheckpointEvery == 0 {
+		checkpoint := core.Checkpoint{
+			Epoch:          epoch,
+			GeneratorState: model.rng.State(),
+			UpdaterStates:  model.updaters.states(),
+		}
+		if err := core.SaveCheckpoint(model.rtOptions.CheckpointFile, self, checkpoint); err != nil {
+			log.Printf("Failed to save checkpoint: %v", err)
+		}
+	}
+	return model.rtOptions.EarlyStopper != nil && model.rtOptions.EarlyStopper.Stop(self, epoch)
+}
+
+// canceled is called by iterative models before each epoch. It returns true
+// if the context is canceled, where fitting is marked as interrupted.
+func (model *BaseModel) canceled() bool {
+	if model.rtOptions.Context.Err() != nil {
+		model.rtOptions.Interrupted = true
+		return true
+	}
+	return false
+}
+
+// partialInit is called by models fitted incrementally. Unseen users and items
+// in the table are added to the ID sets, which are cloned since they might be
+// shared with the training set. Ratings are returned with dense IDs.
+func (model *BaseModel) partialInit(table core.Table, options []base.FitOption) (denseUserIds, denseItemIds []int, ratings []float64) {
+	// Add users and items
+	model.UserIdSet = model.UserIdSet.Clone()
+	model.ItemIdSet = model.ItemIdSet.Clone()
+	denseUserIds = make([]int, 0, table.Len())
+	denseItemIds = make([]int, 0, table.Len())
+	ratings = make([]float64, 0, table.Len())
+	table.ForEach(func(userId, itemId int, rating float64) {
+		model.UserIdSet.Add(userId)
+		model.ItemIdSet.Add(itemId)
+		denseUserIds = append(denseUserIds, model.UserIdSet.ToDenseId(userId))
+		denseItemIds = append(denseItemIds, model.ItemIdSet.ToDenseId(itemId))
+		ratings = append(ratings, rating)
+	})
+	// Setup random state for a loaded model
+	if model.rng.Rand == nil {
+		model.rng = base.NewRandomGenerator(model.randState)
+	}
+	// Setup runtime options
+	model.rtOptions = base.NewFitOptions(options)
+	model.fitStart = time.Now()
+	model.resetItemMatrix()
+	return denseUserIds, denseItemIds, ratings
+}
+
+// foldInUser is called by models folding in a user. The user is added to the ID
+// set, which is cloned since it might be shared with the training set. Ratings
+// are returned with dense IDs, where ratings of unknown items are skipped.
+func (model *BaseModel) foldInUser(userId int, itemIds []int, ratings []float64) (denseUserId int, denseItemIds []int, knownRatings []float64) {
+	if len(itemIds) != len(ratings) {
+		panic(fmt.Sprintf("the number of items (%v) and ratings (%v) don't match", len(itemIds), len(ratings)))
+	}
+	// Add the user
+	if model.UserIdSet.ToDenseId(userId) == base.NotId {
+		model.UserIdSet = model.UserIdSet.Clone()
+		model.UserIdSet.Add(userId)
+	}
+	denseUserId = model.UserIdSet.ToDenseId(userId)
+	// Skip unknown items
+	denseItemIds = make([]int, 0, len(itemIds))
+	knownRatings = make([]float64, 0, len(ratings))
+	for i, itemId := range itemIds {
+		if denseItemId := model.ItemIdSet.ToDenseId(itemId); denseItemId != base.NotId {
+			denseItemIds = append(denseItemIds, denseItemId)
+			knownRatings = append(knownRatings, ratings[i])
+		}
+	}
+	return denseUserId, denseItemIds, knownRatings
+}
+
+// resume is called by iterative models after initialization. If resuming,
+// parameters, the random generator and optimizers are restored from the
+// checkpoint. It returns the number of finished epochs. Fitting starts from
+// scratch if the checkpoint couldn't be loaded.
+func (model *BaseModel) resume(self core.Model) int {
+	if model.rtOptions.ResumeFile == "" {
+		return 0
+	}
+	checkpoint, err := core.LoadCheckpoint(model.rtOptions.ResumeFile, self)
+	if err != nil {
+		log.Printf("Failed to resume from checkpoint: %v", err)
+		return 0
+	}
+	model.rng = base.NewRandomGeneratorFromState(checkpoint.GeneratorState)
+	model.updaters.setStates(checkpoint.UpdaterStates)
+	return checkpoint.Epoch
+}
+
+// parallelLoss splits n tasks into nJobs shards and runs worker on shards in
+// parallel. The worker processes tasks in [begin, end) and returns the sum of
+// losses, which are summed up.
+func (model *BaseModel) parallelLoss(nJobs, n int, worker func(jobId, begin, end int) float64) float64 {
+	losses := make([]float64, nJobs)
+	var wg sync.WaitGroup
+	wg.Add(nJobs)
+	for j := 0; j < nJobs; j++ {
+		go func(jobId int) {
+			losses[jobId] = worker(jobId, n*jobId/nJobs, n*(jobId+1)/nJobs)
+			wg.Done()
+		}(j)
+	}
+	wg.Wait()
+	return floats.Sum(losses)
+}
+
+// sgdJobs returns the number of jobs of SGD. It's NJobs if Hogwild is enabled,
+// where parameters are updated by jobs without locks. Otherwise, SGD is serial.
+func (model *BaseModel) sgdJobs() int {
+	if model.rtOptions.Hogwild {
+		return model.rtOptions.NJobs
+	}
+	return 1
+}
+
+// updaters updates parameters of a SGD-based model by optimizers, where biases
+// are updated as matrices with one column. The learning rate is scheduled by
+// epochs. Updaters of absent parameters are nil.
+type updaters struct {
+	params     base.Params
+	schedule   base.FuncLrSchedule
+	all        []base.Updater
+	userFactor base.Updater
+	itemFactor base.Updater
+	implFactor base.Updater
+	userBias   base.Updater
+	itemBias   base.Updater
+}
+
+// newUpdaters creates updaters with the initial learning rate (lr) for nEpochs
+// epochs. Optimizers and schedules are given by hyper-parameters.
+func (model *BaseModel) newUpdaters(lr float64, nEpochs int) *updaters {
+	return &updaters{
+		params:   model.Params,
+		schedule: base.NewLrSchedule(model.Params, lr, nEpochs),
+	}
+}
+
+// newUpdater creates an updater for a matrix of parameters (rows × cols).
+func (u *updaters) newUpdater(rows, cols int) base.Updater {
+	updater := base.NewUpdater(u.params, rows, cols)
+	u.all = append(u.all, updater)
+	return updater
+}
+
+// setEpoch sets the learning rate of an epoch, which starts from 0.
+func (u *updaters) setEpoch(epoch int) {
+	lr := u.schedule(epoch)
+	for _, updater := range u.all {
+		updater.SetLr(lr)
+	}
+}
+
+// states returns states of optimizers, or nil if there are no updaters.
+func (u *updaters) states() []base.UpdaterState {
+	if u == nil {
+		return nil
+	}
+	states := make([]base.UpdaterState, len(u.all))
+	for i, updater := range u.all {
+		states[i] = updater.State()
+	}
+	return states
+}
+
+// setStates restores states of optimizers. It does nothing if there are no
+// updaters or states don't match updaters.
+func (u *updaters) setStates(states []base.UpdaterState) {
+	if u == nil || len(states) != len(u.all) {
+		return
+	}
+	for i, updater := range u.all {
+		updater.SetState(states[i])
+	}
+}
+
+// restoreBest is called by iterative models at the end of fitting. The best
+// parameters are restored if early stopping is enabled.
+func (model *BaseModel) restoreBest(self core.Model) {
+	if model.rtOptions.EarlyStopper != nil {
+		model.rtOptions.EarlyStopper.Restore(self)
+	}
+	model.resetItemMatrix()
+}
+
+// getItemMatrix returns item factors stacked into a matrix, which is built
+// once and cached until factors are changed by fitting. It's safe to call
+// concurrently.
+func (model *BaseModel) getItemMatrix(itemFactors [][]float64, nFactors int) *mat.Dense {
+	model.itemMatrixLock.Lock()
+	defer model.itemMatrixLock.Unlock()
+	if model.itemMatrix == nil {
+		model.itemMatrix = factorMatrix(itemFactors, nFactors)
+	}
+	return model.itemMatrix
+}
+
+// resetItemMatrix drops the cached item matrix after item factors are changed.
+func (model *BaseModel) resetItemMatrix() {
+	model.itemMatrixLock.Lock()
+	defer model.itemMatrixLock.Unlock()
+	model.itemMatrix = nil
+}
+
+// toDenseUserIds converts user IDs to dense user IDs.
+func (model *BaseModel) toDenseUserIds(userIds []int) []int {
+	denseUserIds := make([]int, len(userIds))
+	for i, userId := range userIds {
+		denseUserIds[i] = model.UserIdSet.ToDenseId(userId)
+	}
+	return denseUserIds
+}
+
+// toDenseItemIds converts item IDs to dense item IDs.
+func (model *BaseModel) toDenseItemIds(itemIds []int) []int {
+	denseItemIds := make([]int, len(itemIds))
+	for i, itemId := range itemIds {
+		denseItemIds[i] = model.ItemIdSet.ToDenseId(itemId)
+	}
+	return denseItemIds
+}
+
+// dotRows computes dst[i] = x^T factors[denseIds[i]] without copying factors,
+// where scores of unknown IDs are zeros.
+func dotRows(dst []float64, factors [][]float64, denseIds []int, x []float64) {
+	for i, denseId := range denseIds {
+		if denseId != base.NotId {
+			dst[i] = floats.Dot(x, factors[denseId])
+		}
+	}
+}
+
+// factorRows stacks factors of dense IDs into a matrix, where rows of unknown
+// IDs are zeros.
+func factorRows(factors [][]float64, denseIds []int, nFactors int) *mat.Dense {
+	rows := mat.NewDense(len(denseIds), nFactors, nil)
+	for i, denseId := range denseIds {
+		if denseId != base.NotId {
+			rows.SetRow(i, factors[denseId])
+		}
+	}
+	return rows
+}
+
+// factorMatrix stacks all factors into a matrix.
+func factorMatrix(factors [][]float64, nFactors int) *mat.Dense {
+	matrix := mat.NewDense(len(factors), nFactors, nil)
+	for i := range factors {
+		matrix.SetRow(i, factors[i])
+	}
+	return matrix
+}
+
+// mulVec computes dst = a x.
+func mulVec(dst []float64, a mat.Matrix, x []float64) {
+	mat.NewVecDense(len(dst), dst).MulVec(a, mat.NewVecDense(len(x), x))
+}
+
+// similarFactors finds top-n IDs most similar to an ID by the cosine similarity
+// between factors, where the i-th row of factors belongs to the i-th ID.
+func similarFactors(idSet *base.SparseIdSet, factors *mat.Dense, id int, n int) ([]int, []float64) {
+	denseId := idSet.ToDenseId(id)
+	if denseId == base.NotId {
+		return []int{}, []float64{}
+	}
+	// \frac{q_i^Tq_j}{|q_i||q_j|}
+	similarities := make([]float64, idSet.Len())
+	factor := factors.RawRowView(denseId)
+	mulVec(similarities, factors, factor)
+	norm := floats.Norm(factor, 2)
+	for i := range similarities {
+		similarities[i] /= norm * floats.Norm(factors.RawRowView(i), 2)
+	}
+	return core.TopSimilar(idSet.SparseIds, similarities, id, n)
 }
 
 /* Random */
@@ -83,6 +411,11 @@ func (random *Random) Predict(userId int, itemId int) float64 {
 	return ret
 }
 
+// Recommend recommends top-n items to a user.
+func (random *Random) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(random, userId, n, random.ItemIdSet.SparseIds, options...)
+}
+
 func (random *Random) Fit(trainSet core.DataSet, options ...base.FitOption) {
 	random.Init(trainSet, options)
 	random.Mean = trainSet.Mean()
@@ -113,6 +446,8 @@ type BaseLine struct {
 // 				  optimized. Default is 0.02.
 //	 Lr 		- The learning rate of SGD. Default is 0.005.
 //	 NEpochs	- The number of iteration of the SGD procedure. Default is 20.
+//	 Optimizer	- The optimizer of biases. See base.NewUpdater.
+//	 LrSchedule	- The schedule of the learning rate. See base.NewLrSchedule.
 func NewBaseLine(params base.Params) *BaseLine {
 	baseLine := new(BaseLine)
 	baseLine.SetParams(params)
@@ -133,6 +468,11 @@ func (baseLine *BaseLine) Predict(userId, itemId int) float64 {
 	return baseLine.predict(denseUserId, denseItemId)
 }
 
+// Recommend recommends top-n items to a user.
+func (baseLine *BaseLine) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(baseLine, userId, n, baseLine.ItemIdSet.SparseIds, options...)
+}
+
 func (baseLine *BaseLine) predict(denseUserId, denseItemId int) float64 {
 	ret := baseLine.GlobalBias
 	if denseUserId != base.NotId {
@@ -150,21 +490,73 @@ func (baseLine *BaseLine) Fit(trainSet core.DataSet, options ...base.FitOption)
 	baseLine.GlobalBias = trainSet.GlobalMean
 	baseLine.UserBias = make([]float64, trainSet.UserCount())
 	baseLine.ItemBias = make([]float64, trainSet.ItemCount())
+	baseLine.initUpdaters(baseLine.nEpochs)
 	// Stochastic Gradient Descent
-	for epoch := 0; epoch < baseLine.nEpochs; epoch++ {
+	buffer := make([]float64, 1)
+	for epoch := baseLine.resume(baseLine); epoch < baseLine.nEpochs && !baseLine.canceled(); epoch++ {
+		baseLine.updaters.setEpoch(epoch)
+		loss := 0.0
 		for i := 0; i < trainSet.Len(); i++ {
 			denseUserId, denseItemId, rating := trainSet.GetDense(i)
-			userBias := baseLine.UserBias[denseUserId]
-			itemBias := baseLine.ItemBias[denseItemId]
-			// Compute gradient
-			diff := baseLine.predict(denseUserId, denseItemId) - rating
-			gradUserBias := diff + baseLine.reg*userBias
-			gradItemBias := diff + baseLine.reg*itemBias
-			// Update parameters
-			baseLine.UserBias[denseUserId] -= baseLine.lr * gradUserBias
-			baseLine.ItemBias[denseItemId] -= baseLine.lr * gradItemBias
+			loss += baseLine.sgd(denseUserId, denseItemId, rating, buffer)
+		}
+		if baseLine.epochEnd(baseLine, epoch+1, loss/float64(trainSet.Len())) {
+			break
 		}
 	}
+	baseLine.restoreBest(baseLine)
+}
+
+// initUpdaters creates updaters of parameters for nEpochs epochs.
+func (baseLine *BaseLine) initUpdaters(nEpochs int) {
+	baseLine.updaters = baseLine.newUpdaters(baseLine.lr, nEpochs)
+	baseLine.updaters.userBias = baseLine.updaters.newUpdater(len(baseLine.UserBias), 1)
+	baseLine.updaters.itemBias = baseLine.updaters.newUpdater(len(baseLine.ItemBias), 1)
+}
+
+// sgd updates parameters by a rating and returns the squared error, where
+// buffer is a slice of length one.
+func (baseLine *BaseLine) sgd(denseUserId, denseItemId int, rating float64, buffer []float64) float64 {
+	userBias := baseLine.UserBias[denseUserId]
+	itemBias := baseLine.ItemBias[denseItemId]
+	// Compute gradient
+	diff := baseLine.predict(denseUserId, denseItemId) - rating
+	gradUserBias := diff + baseLine.reg*userBias
+	gradItemBias := diff + baseLine.reg*itemBias
+	// Update parameters in descent directions
+	buffer[0] = -gradUserBias
+	baseLine.updaters.userBias.Update(denseUserId, baseLine.UserBias[denseUserId:denseUserId+1], buffer)
+	buffer[0] = -gradItemBias
+	baseLine.updaters.itemBias.Update(denseItemId, baseLine.ItemBias[denseItemId:denseItemId+1], buffer)
+	return diff * diff
+}
+
+// PartialFit updates the model with new ratings by nEpochs passes of SGD. Unseen
+// users and items are added with zero biases. Optimizers start from fresh
+// states in each call, where the learning rate is scheduled over nEpochs.
+func (baseLine *BaseLine) PartialFit(table core.Table, nEpochs int, options ...base.FitOption) {
+	denseUserIds, denseItemIds, ratings := baseLine.partialInit(table, options)
+	// Initialize new users and items
+	for len(baseLine.UserBias) < baseLine.UserIdSet.Len() {
+		baseLine.UserBias = append(baseLine.UserBias, 0)
+	}
+	for len(baseLine.ItemBias) < baseLine.ItemIdSet.Len() {
+		baseLine.ItemBias = append(baseLine.ItemBias, 0)
+	}
+	// Stochastic Gradient Descent
+	baseLine.initUpdaters(nEpochs)
+	buffer := make([]float64, 1)
+	for epoch := 0; epoch < nEpochs && !baseLine.canceled(); epoch++ {
+		baseLine.updaters.setEpoch(epoch)
+		loss := 0.0
+		for i := range ratings {
+			loss += baseLine.sgd(denseUserIds[i], denseItemIds[i], ratings[i], buffer)
+		}
+		if baseLine.epochEnd(baseLine, epoch+1, loss/float64(len(ratings))) {
+			break
+		}
+	}
+	baseLine.restoreBest(baseLine)
 }
 
 // ItemPop recommends items by their popularity.
@@ -197,3 +589,8 @@ func (pop *ItemPop) Predict(userId, itemId int) float64 {
 	}
 	return pop.Pop[denseItemId]
 }
+
+// Recommend recommends top-n items to a user.
+func (pop *ItemPop) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(pop, userId, n, pop.ItemIdSet.SparseIds, options...)
+}
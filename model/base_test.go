@@ -0,0 +1,446 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/core"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBaseModel_RawIds(t *testing.T) {
+	data := core.LoadDataFromCSV("../example/data/string_ids.csv", ",", true, core.WithStringIds())
+	baseLine := NewBaseLine(nil)
+	baseLine.Fit(data)
+	// Raw IDs go in
+	userId, itemId := baseLine.UserId("a3f1c2de"), baseLine.ItemId("SKU-1003")
+	assert.NotEqual(t, base.NotId, userId)
+	assert.NotEqual(t, base.NotId, itemId)
+	assert.Equal(t, baseLine.predict(data.UserIdSet.ToDenseId(userId), data.ItemIdSet.ToDenseId(itemId)),
+		baseLine.Predict(userId, itemId))
+	// Raw IDs come out
+	assert.Equal(t, "a3f1c2de", baseLine.RawUserId(userId))
+	assert.Equal(t, "SKU-1003", baseLine.RawItemId(itemId))
+	assert.Equal(t, base.NotId, baseLine.UserId("unknown"))
+	assert.Equal(t, "", baseLine.RawItemId(base.NotId))
+	// Recommend by raw IDs
+	items, scores := baseLine.Recommend(userId, 3)
+	rawItems, rawScores := core.RecommendRaw(baseLine, baseLine, "a3f1c2de", 3)
+	assert.Equal(t, scores, rawScores)
+	for i := range items {
+		assert.Equal(t, baseLine.RawItemId(items[i]), rawItems[i])
+	}
+}
+
+func TestRecommender(t *testing.T) {
+	// All models are recommenders
+	models := []core.Model{
+		NewRandom(nil), NewBaseLine(nil), NewItemPop(nil), NewCoClustering(nil), NewKNN(nil),
+		NewSlopOne(nil), NewSVD(nil), NewNMF(nil), NewSVDpp(nil), NewWRMF(nil),
+	}
+	for _, model := range models {
+		_, ok := model.(core.Recommender)
+		assert.True(t, ok)
+	}
+	// Recommend items
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	baseLine := NewBaseLine(nil)
+	baseLine.Fit(data)
+	items, scores := baseLine.Recommend(1, 10)
+	assert.Equal(t, 10, len(items))
+	for i := range items {
+		assert.Equal(t, baseLine.Predict(1, items[i]), scores[i])
+		if i > 0 {
+			assert.True(t, scores[i-1] >= scores[i])
+		}
+	}
+	// Exclude rated items, blocked items and items not in candidates
+	candidates := data.ItemIdSet.SparseIds[:100]
+	excluded := make(map[int]bool)
+	for _, itemId := range items {
+		excluded[itemId] = true
+	}
+	data.DenseUserRatings[data.UserIdSet.ToDenseId(1)].ForEach(func(i, index int, value float64) {
+		excluded[data.ItemIdSet.ToSparseId(index)] = true
+	})
+	items, _ = baseLine.Recommend(1, 10, core.WithExcludeRated(data),
+		core.WithBlockList(items), core.WithCandidates(candidates))
+	assert.Equal(t, 10, len(items))
+	for _, itemId := range items {
+		assert.False(t, excluded[itemId])
+		assert.Contains(t, candidates, itemId)
+	}
+}
+
+func TestBatchPredictor(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	train, _ := core.Split(data, 0.2, 0)
+	models := []core.Model{
+		NewSVD(base.Params{base.NEpochs: 5}),
+		NewSVDpp(base.Params{base.NEpochs: 1}),
+		NewNMF(base.Params{base.NEpochs: 5}),
+		NewWRMF(base.Params{base.NEpochs: 1}),
+	}
+	// Include an unknown user and an unknown item
+	userIds := []int{1, 2, 3, 1 << 20}
+	itemIds := append([]int{1 << 20}, train.ItemIdSet.SparseIds[:100]...)
+	check := func(model core.Model) {
+		predictor, ok := model.(core.BatchPredictor)
+		assert.True(t, ok)
+		// One user against many items
+		for _, userId := range userIds {
+			scores := predictor.PredictItems(userId, itemIds)
+			for i, itemId := range itemIds {
+				assert.InDelta(t, model.Predict(userId, itemId), scores[i], 1e-9)
+			}
+		}
+		// Many users against all items
+		allItemIds, allScores := predictor.PredictAll(userIds)
+		assert.Equal(t, train.ItemIdSet.SparseIds, allItemIds)
+		for i, userId := range userIds {
+			for j, itemId := range allItemIds {
+				assert.InDelta(t, model.Predict(userId, itemId), allScores.At(i, j), 1e-9)
+			}
+		}
+	}
+	for _, model := range models {
+		model.Fit(train)
+		check(model)
+		// Cached item factors are updated after fitting
+		if partialFitter, ok := model.(core.PartialFitter); ok {
+			partialFitter.PartialFit(train.SubSet([]int{0, 1, 2}), 1)
+			check(model)
+		}
+	}
+}
+
+func TestSimilarFinder(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	// Factor models use cosine similarity between factors
+	svd := NewSVD(base.Params{base.NEpochs: 5})
+	svd.Fit(data)
+	items, similarities := svd.SimilarItems(1, 10)
+	assert.Equal(t, 10, len(items))
+	for i, itemId := range items {
+		assert.NotEqual(t, 1, itemId)
+		a, b := svd.ItemFactor[data.ItemIdSet.ToDenseId(1)], svd.ItemFactor[data.ItemIdSet.ToDenseId(itemId)]
+		assert.InDelta(t, floats.Dot(a, b)/floats.Norm(a, 2)/floats.Norm(b, 2), similarities[i], 1e-9)
+		if i > 0 {
+			assert.True(t, similarities[i-1] >= similarities[i])
+		}
+	}
+	users, _ := svd.SimilarUsers(1, 10)
+	assert.Equal(t, 10, len(users))
+	assert.NotContains(t, users, 1)
+	users, _ = svd.SimilarUsers(1<<20, 10)
+	assert.Equal(t, 0, len(users))
+	// KNN uses SimMatrix or the generic version
+	userBased := NewKNN(base.Params{base.Similarity: base.Cosine})
+	userBased.Fit(data)
+	itemBased := NewKNN(base.Params{base.Similarity: base.Cosine, base.UserBased: false})
+	itemBased.Fit(data)
+	expectItems, expectSimilarities := core.SimilarItems(data, 1, 10, base.CosineSimilarity)
+	items, similarities = userBased.SimilarItems(1, 10)
+	assert.Equal(t, expectItems, items)
+	assert.Equal(t, expectSimilarities, similarities)
+	denseItemId := data.ItemIdSet.ToDenseId(1)
+	items, similarities = itemBased.SimilarItems(1, 10)
+	for i, itemId := range items {
+		assert.Equal(t, itemBased.SimMatrix[denseItemId][data.ItemIdSet.ToDenseId(itemId)], similarities[i])
+	}
+	// All models with factors or similarities are similar finders
+	for _, model := range []core.Model{NewKNN(nil), NewSVD(nil), NewNMF(nil), NewWRMF(nil)} {
+		_, ok := model.(core.SimilarFinder)
+		assert.True(t, ok)
+	}
+}
+
+func TestWithEarlyStopping(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	train, valid := core.Split(data, 0.2, 0)
+	params := base.Params{base.NEpochs: 30, base.Lr: 0.05}
+	models := []func() core.Model{
+		func() core.Model { return NewSVD(params) },
+		func() core.Model { return NewBaseLine(params) },
+		func() core.Model { return NewCoClustering(base.Params{base.NEpochs: 10}) },
+	}
+	for _, newModel := range models {
+		// Record scores after each epoch
+		scores := make([]float64, 0)
+		evaluator := func(estimator core.Model, testSet core.DataSet, option ...core.EvaluatorOption) float64 {
+			score := core.RMSE(estimator, testSet, option...)
+			scores = append(scores, score)
+			return score
+		}
+		// Stop early and keep the best parameters
+		early := newModel()
+		early.Fit(train, core.WithEarlyStopping(valid, evaluator, 2))
+		assert.Equal(t, floats.Min(scores), core.RMSE(early, valid))
+	}
+}
+
+func TestWithCallback(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	params := base.Params{base.NEpochs: 3, base.NFactors: 5}
+	models := []core.Model{
+		NewSVD(params), NewSVD(base.Params{base.NEpochs: 3, base.NFactors: 5, base.Target: base.BPR}), NewSVDpp(params),
+		NewNMF(params), NewWRMF(params), NewCoClustering(params), NewBaseLine(params),
+	}
+	for _, model := range models {
+		epochs := make([]int, 0)
+		var lastElapsed time.Duration
+		model.Fit(data, base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+			epochs = append(epochs, epoch)
+			assert.False(t, math.IsNaN(loss) || math.IsInf(loss, 0))
+			assert.True(t, elapsed >= lastElapsed)
+			lastElapsed = elapsed
+		}))
+		assert.Equal(t, []int{1, 2, 3}, epochs)
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	// Cancel after the second epoch
+	ctx, cancel := context.WithCancel(context.Background())
+	epochs := 0
+	svd := NewSVD(base.Params{base.NEpochs: 10})
+	err := core.FitContext(ctx, svd, data, base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+		if epochs = epoch; epoch == 2 {
+			cancel()
+		}
+	}))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 2, epochs)
+	// The partially fitted model is kept
+	partial := NewSVD(base.Params{base.NEpochs: 2})
+	partial.Fit(data)
+	assert.Equal(t, partial.Predict(1, 1), svd.Predict(1, 1))
+	// Canceled after the last epoch
+	ctx, cancel = context.WithCancel(context.Background())
+	svd = NewSVD(base.Params{base.NEpochs: 2})
+	err = core.FitContext(ctx, svd, data, base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+		if epoch == 2 {
+			cancel()
+		}
+	}))
+	assert.Nil(t, err)
+}
+
+func TestWithCheckpoint(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	params := base.Params{base.NEpochs: 4, base.NFactors: 5}
+	bprParams := base.Params{base.NEpochs: 4, base.NFactors: 5, base.Target: base.BPR}
+	adamParams := base.Params{base.NEpochs: 4, base.NFactors: 5, base.Optimizer: base.Adam}
+	models := []func() core.Model{
+		func() core.Model { return NewSVD(params) },
+		func() core.Model { return NewSVD(bprParams) },
+		func() core.Model { return NewSVDpp(params) },
+		func() core.Model { return NewNMF(params) },
+		func() core.Model { return NewWRMF(params) },
+		func() core.Model { return NewCoClustering(params) },
+		func() core.Model { return NewBaseLine(params) },
+		// Optimizers are restored
+		func() core.Model { return NewSVD(adamParams) },
+		func() core.Model { return NewSVDpp(adamParams) },
+		func() core.Model { return NewBaseLine(adamParams) },
+	}
+	for i, newModel := range models {
+		fileName := filepath.Join(core.TempDir, fmt.Sprintf("/checkpoint_%d.m", i))
+		// Fit without interruption
+		full := newModel()
+		full.Fit(data)
+		// Interrupted after the second epoch
+		ctx, cancel := context.WithCancel(context.Background())
+		interrupted := newModel()
+		core.FitContext(ctx, interrupted, data, base.WithCheckpoint(fileName, 1),
+			base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+				if epoch == 2 {
+					cancel()
+				}
+			}))
+		// Resume from the checkpoint
+		epochs := make([]int, 0)
+		resumed := newModel()
+		resumed.Fit(data, base.WithResume(fileName), base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+			epochs = append(epochs, epoch)
+		}))
+		assert.Equal(t, []int{3, 4}, epochs)
+		for _, userId := range []int{1, 2, 3} {
+			for _, itemId := range []int{1, 2, 3} {
+				assert.Equal(t, full.Predict(userId, itemId), resumed.Predict(userId, itemId))
+			}
+		}
+	}
+	// Start from scratch if the checkpoint is missing
+	full := NewBaseLine(params)
+	full.Fit(data)
+	resumed := NewBaseLine(params)
+	resumed.Fit(data, base.WithResume(filepath.Join(core.TempDir, "missing.m")))
+	assert.Equal(t, full.Predict(1, 1), resumed.Predict(1, 1))
+	// Start from scratch if the checkpoint is saved on another training set
+	indices := make([]int, 0)
+	for i := 0; i < data.Len(); i++ {
+		if userId, _, _ := data.Get(i); userId <= 843 {
+			indices = append(indices, i)
+		}
+	}
+	subset := core.NewDataSet(data.SubSet(indices))
+	for i, newModel := range models[:5] {
+		fileName := filepath.Join(core.TempDir, fmt.Sprintf("/checkpoint_subset_%d.m", i))
+		newModel().Fit(subset, base.WithCheckpoint(fileName, 1))
+		full := newModel()
+		full.Fit(data)
+		resumed := newModel()
+		resumed.Fit(data, base.WithResume(fileName))
+		assert.Equal(t, full.Predict(1, 1), resumed.Predict(1, 1))
+	}
+}
+
+func TestPartialFit(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	// Ratings from the last 100 users arrive later
+	oldIndices, newIndices := make([]int, 0), make([]int, 0)
+	for i := 0; i < data.Len(); i++ {
+		if userId, _, _ := data.Get(i); userId <= 843 {
+			oldIndices = append(oldIndices, i)
+		} else {
+			newIndices = append(newIndices, i)
+		}
+	}
+	oldSet := core.NewDataSet(data.SubSet(oldIndices))
+	newSet := core.NewDataSet(data.SubSet(newIndices))
+	params := base.Params{base.NEpochs: 5, base.NFactors: 5}
+	svd, svdpp, baseLine := NewSVD(params), NewSVDpp(params), NewBaseLine(params)
+	models := []core.Model{svd, svdpp, baseLine}
+	userIdSets := []*base.SparseIdSet{&svd.UserIdSet, &svdpp.UserIdSet, &baseLine.UserIdSet}
+	for i, model := range models {
+		model.Fit(oldSet)
+		before := core.RMSE(model, newSet)
+		fitter, ok := model.(core.PartialFitter)
+		assert.True(t, ok)
+		fitter.PartialFit(newSet, 5)
+		assert.True(t, core.RMSE(model, newSet) < before)
+		// New users are added to the model but not to the old training set
+		assert.Equal(t, data.UserCount(), userIdSets[i].Len())
+		assert.Equal(t, 843, oldSet.UserCount())
+		assert.Equal(t, base.NotId, oldSet.UserIdSet.ToDenseId(943))
+	}
+}
+
+func TestFoldIn(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	// Fold in a copy of user 1
+	itemIds, ratings := make([]int, 0), make([]float64, 0)
+	data.DenseUserRatings[data.UserIdSet.ToDenseId(1)].ForEach(func(i, index int, value float64) {
+		itemIds = append(itemIds, data.ItemIdSet.ToSparseId(index))
+		ratings = append(ratings, value)
+	})
+	newUserId := 1 << 20
+	// WRMF solves the same factor as a fitted user
+	wrmfParams := base.Params{base.NEpochs: 20, base.NFactors: 5}
+	wrmf := NewWRMF(wrmfParams)
+	wrmf.Fit(data)
+	assert.Equal(t, 0.0, wrmf.Predict(newUserId, 1))
+	loaded := NewWRMF(wrmfParams)
+	if err := core.Copy(loaded, wrmf); err != nil {
+		t.Fatal(err)
+	}
+	wrmf.FoldIn(newUserId, itemIds, ratings)
+	for _, itemId := range data.ItemIdSet.SparseIds[:100] {
+		assert.InDelta(t, wrmf.Predict(1, itemId), wrmf.Predict(newUserId, itemId), 0.01)
+	}
+	// A loaded model solves the same factor
+	loaded.FoldIn(newUserId, itemIds, ratings)
+	for _, itemId := range data.ItemIdSet.SparseIds[:100] {
+		assert.InDelta(t, wrmf.Predict(newUserId, itemId), loaded.Predict(newUserId, itemId), 1e-9)
+	}
+	// SVD fits the ratings of the new user
+	svd := NewSVD(base.Params{base.NEpochs: 10, base.NFactors: 5})
+	svd.Fit(data)
+	rmse := func() float64 {
+		sum := 0.0
+		for i, itemId := range itemIds {
+			sum += (svd.Predict(newUserId, itemId) - ratings[i]) * (svd.Predict(newUserId, itemId) - ratings[i])
+		}
+		return math.Sqrt(sum / float64(len(ratings)))
+	}
+	before := rmse()
+	svd.FoldIn(newUserId, itemIds, ratings)
+	assert.True(t, rmse() < before)
+	// SVD folds in by the optimizer of the model
+	svd = NewSVD(base.Params{base.NEpochs: 10, base.NFactors: 5, base.Optimizer: base.Adam, base.FoldInEpochs: 5})
+	svd.Fit(data)
+	before = rmse()
+	svd.FoldIn(newUserId, itemIds, ratings)
+	assert.True(t, rmse() < before)
+	// The training set is not modified
+	assert.Equal(t, base.NotId, data.UserIdSet.ToDenseId(newUserId))
+}
+
+func TestOptimizer(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	for _, optimizer := range []base.ParamString{base.MomentumSGD, base.AdaGrad, base.Adam} {
+		for _, schedule := range []base.ParamString{base.ConstantLr, base.StepLr, base.ExponentialLr, base.CosineLr} {
+			params := base.Params{
+				base.NEpochs:    5,
+				base.NFactors:   5,
+				base.Optimizer:  optimizer,
+				base.Momentum:   0.5,
+				base.LrSchedule: schedule,
+				base.LrStepSize: 2,
+			}
+			batchParams := params.Copy()
+			batchParams[base.BatchSize] = 64
+			models := []core.Model{NewSVD(params), NewSVD(batchParams), NewSVDpp(params), NewBaseLine(params)}
+			for _, model := range models {
+				// Training losses decrease
+				losses := make([]float64, 0)
+				model.Fit(data, base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+					losses = append(losses, loss)
+				}))
+				assert.True(t, losses[len(losses)-1] < losses[0], "%v %v %v", reflect.TypeOf(model), optimizer, schedule)
+			}
+		}
+	}
+}
+
+func TestWRMF_Solver(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	params := base.Params{base.NEpochs: 5, base.NFactors: 10}
+	fit := func(params base.Params) (*WRMF, float64) {
+		var lastLoss float64
+		model := NewWRMF(params)
+		model.Fit(data, base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+			lastLoss = loss
+		}))
+		return model, lastLoss
+	}
+	// Conjugate gradient converges as well as Cholesky decomposition
+	cholesky, choleskyLoss := fit(params)
+	cgParams := params.Copy()
+	cgParams[base.Solver] = base.CG
+	_, cgLoss := fit(cgParams)
+	assert.InEpsilon(t, choleskyLoss, cgLoss, 0.05)
+	// Alpha changes confidence
+	alphaParams := params.Copy()
+	alphaParams[base.Alpha] = 10.0
+	alpha, _ := fit(alphaParams)
+	assert.NotEqual(t, cholesky.Predict(1, 1), alpha.Predict(1, 1))
+	// Singular systems are skipped
+	singular := NewWRMF(base.Params{base.NFactors: 2, base.Reg: 0.0})
+	fixed := mat.NewDense(1, 2, nil)
+	dst := []float64{1, 2}
+	ratings := base.SparseVector{Indices: []int{0}, Values: []float64{1}}
+	assert.False(t, singular.newSolver().solve(dst, fixed, singular.gram(fixed), &ratings))
+	assert.Equal(t, []float64{1, 2}, dst)
+	// Unknown solver
+	assert.Panics(t, func() { NewWRMF(base.Params{base.Solver: base.ParamString("unknown")}) })
+}
@@ -47,6 +47,11 @@ func (coc *CoClustering) Predict(userId, itemId int) float64 {
 	return coc.predict(denseUserId, denseItemId)
 }
 
+// Recommend recommends top-n items to a user.
+func (coc *CoClustering) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(coc, userId, n, coc.ItemIdSet.SparseIds, options...)
+}
+
 func (coc *CoClustering) predict(denseUserId, denseItemId int) float64 {
 	prediction := 0.0
 	if denseUserId != base.NotId && denseItemId != base.NotId {
@@ -90,7 +95,7 @@ func (coc *CoClustering) Fit(trainSet core.DataSet, options ...base.FitOption) {
 		})
 	}
 	// Clustering
-	for ep := 0; ep < coc.nEpochs; ep++ {
+	for ep := coc.resume(coc); ep < coc.nEpochs && !coc.canceled(); ep++ {
 		// Compute averages A^{COC}, A^{RC}, A^{CC}, A^R, A^C
 		coc.clusterMean(coc.UserClusterMeans, coc.UserClusters, userRatings)
 		coc.clusterMean(coc.ItemClusterMeans, coc.ItemClusters, itemRatings)
@@ -117,6 +122,7 @@ func (coc *CoClustering) Fit(trainSet core.DataSet, options ...base.FitOption) {
 			coc.UserClusters[denseUserId] = bestCluster
 		}
 		// Update column (item) cluster assignments
+		loss := 0.0
 		for denseItemId := 0; denseItemId < trainSet.ItemCount(); denseItemId++ {
 			bestCluster, leastCost := -1, math.Inf(1)
 			for h := 0; h < coc.nItemClusters; h++ {
@@ -135,8 +141,13 @@ func (coc *CoClustering) Fit(trainSet core.DataSet, options ...base.FitOption) {
 				}
 			}
 			coc.ItemClusters[denseItemId] = bestCluster
+			loss += leastCost
+		}
+		if coc.epochEnd(coc, ep+1, loss/float64(trainSet.Len())) {
+			break
 		}
 	}
+	coc.restoreBest(coc)
 }
 
 func (coc *CoClustering) clusterMean(dst []float64, clusters []int, ratings []base.SparseVector) {
@@ -111,6 +111,39 @@ func (knn *KNN) Predict(userId, itemId int) float64 {
 	return prediction
 }
 
+// Recommend recommends top-n items to a user.
+func (knn *KNN) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(knn, userId, n, knn.ItemIdSet.SparseIds, options...)
+}
+
+// SimilarItems returns top-n items most similar to an item. Similarities are
+// taken from SimMatrix if the KNN is item-based, otherwise they are computed
+// between ratings of items.
+func (knn *KNN) SimilarItems(itemId int, n int) ([]int, []float64) {
+	if knn.userBased {
+		return core.SimilarByRatings(knn.RightRatings, knn.ItemIdSet, itemId, n, knn.similarity)
+	}
+	return knn.similarLeft(&knn.ItemIdSet, itemId, n)
+}
+
+// SimilarUsers returns top-n users most similar to a user. Similarities are
+// taken from SimMatrix if the KNN is user-based, otherwise they are computed
+// between ratings of users.
+func (knn *KNN) SimilarUsers(userId int, n int) ([]int, []float64) {
+	if knn.userBased {
+		return knn.similarLeft(&knn.UserIdSet, userId, n)
+	}
+	return core.SimilarByRatings(knn.RightRatings, knn.UserIdSet, userId, n, knn.similarity)
+}
+
+func (knn *KNN) similarLeft(idSet *base.SparseIdSet, id int, n int) ([]int, []float64) {
+	denseId := idSet.ToDenseId(id)
+	if denseId == base.NotId {
+		return []int{}, []float64{}
+	}
+	return core.TopSimilar(idSet.SparseIds, knn.SimMatrix[denseId], id, n)
+}
+
 // Fit a KNN model.
 func (knn *KNN) Fit(trainSet core.DataSet, options ...base.FitOption) {
 	knn.Init(trainSet, options)
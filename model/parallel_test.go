@@ -6,6 +6,7 @@ import (
 	"github.com/zhenghaoz/gorse/core"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func ModelParallelTest(t *testing.T, models ...core.Model) {
@@ -27,5 +28,65 @@ func ModelParallelTest(t *testing.T, models ...core.Model) {
 func TestModelParallel(t *testing.T) {
 	ModelParallelTest(t,
 		NewSlopOne(nil),
-		NewKNN(nil))
+		NewKNN(nil),
+		NewNMF(nil),
+		NewWRMF(base.Params{base.NEpochs: 5}),
+		NewSVD(base.Params{base.NEpochs: 5}),
+		NewSVD(base.Params{base.NEpochs: 5, base.Target: base.BPR}),
+		NewSVDpp(base.Params{base.NEpochs: 5}))
+}
+
+func TestHogwild(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	params := base.Params{base.NEpochs: 10, base.NFactors: 10}
+	bprParams := base.Params{base.NEpochs: 10, base.NFactors: 10, base.Target: base.BPR}
+	models := []func() core.Model{
+		func() core.Model { return NewSVD(params) },
+		func() core.Model { return NewSVD(bprParams) },
+		func() core.Model { return NewSVDpp(params) },
+	}
+	for _, newModel := range models {
+		// Training losses of serial SGD and Hogwild SGD should be close
+		losses := make([]float64, 2)
+		for i, nJobs := range []int{1, 4} {
+			model := newModel()
+			model.Fit(data, base.WithNJobs(nJobs), base.WithHogwild(true), base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+				losses[i] = loss
+			}))
+		}
+		assert.InEpsilon(t, losses[0], losses[1], 0.05)
+	}
+}
+
+func TestMiniBatch(t *testing.T) {
+	data := core.LoadDataFromBuiltIn("ml-100k")
+	params := base.Params{base.NEpochs: 5, base.NFactors: 10, base.BatchSize: 64}
+	adamParams := base.Params{base.NEpochs: 5, base.NFactors: 10, base.BatchSize: 64, base.Optimizer: base.Adam}
+	momentumParams := base.Params{base.NEpochs: 5, base.NFactors: 10, base.BatchSize: 64, base.Optimizer: base.MomentumSGD}
+	models := []func() core.Model{
+		func() core.Model { return NewSVD(params) },
+		func() core.Model { return NewSVDpp(params) },
+		// Optimizers take one step per batch
+		func() core.Model { return NewSVD(adamParams) },
+		func() core.Model { return NewSVDpp(adamParams) },
+		func() core.Model { return NewSVD(momentumParams) },
+		func() core.Model { return NewSVDpp(momentumParams) },
+	}
+	for _, newModel := range models {
+		// Training losses decrease
+		losses := make([]float64, 0)
+		serial := newModel()
+		serial.Fit(data, base.WithNJobs(1), base.WithCallback(func(epoch int, loss float64, elapsed time.Duration) {
+			losses = append(losses, loss)
+		}))
+		assert.True(t, losses[len(losses)-1] < losses[0])
+		// Batches computed in parallel give the same model
+		parallel := newModel()
+		parallel.Fit(data, base.WithNJobs(4))
+		for _, userId := range []int{1, 2, 3} {
+			for _, itemId := range []int{1, 2, 3} {
+				assert.InDelta(t, serial.Predict(userId, itemId), parallel.Predict(userId, itemId), 1e-9)
+			}
+		}
+	}
 }
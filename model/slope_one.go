@@ -45,6 +45,11 @@ func (so *SlopeOne) Predict(userId, itemId int) float64 {
 	return prediction
 }
 
+// Recommend recommends top-n items to a user.
+func (so *SlopeOne) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(so, userId, n, so.ItemIdSet.SparseIds, options...)
+}
+
 func (so *SlopeOne) Fit(trainSet core.DataSet, setters ...base.FitOption) {
 	so.Init(trainSet, setters)
 	so.GlobalMean = trainSet.GlobalMean
@@ -8,7 +8,8 @@ import (
 	"gonum.org/v1/gonum/mat"
 	"log"
 	"math"
-	"sync"
+	"sort"
+	"sync/atomic"
 )
 
 /* SVD */
@@ -29,15 +30,16 @@ type SVD struct {
 	ItemBias   []float64   // b_i
 	GlobalMean float64     // mu
 	// Hyper parameters
-	useBias    bool
-	nFactors   int
-	nEpochs    int
-	lr         float64
-	reg        float64
-	initMean   float64
-	initStdDev float64
-	batchSize  int
-	target     base.ParamString
+	useBias      bool
+	nFactors     int
+	nEpochs      int
+	lr           float64
+	reg          float64
+	initMean     float64
+	initStdDev   float64
+	batchSize    int
+	target       base.ParamString
+	foldInEpochs int
 }
 
 // NewSVD creates a SVD model. Params:
@@ -49,6 +51,12 @@ type SVD struct {
 //	 NEpochs	- The number of iteration of the SGD procedure. Default is 20.
 //	 InitMean	- The mean of initial random latent factors. Default is 0.
 //	 InitStdDev	- The standard deviation of initial random latent factors. Default is 0.1.
+//	 BatchSize	- The number of ratings in a mini-batch for the regression target. Default
+//				  is 1, which means SGD without mini-batches. Gradients in a batch are
+//				  summed up, not averaged.
+//	 Optimizer	- The optimizer of latent factors and biases. See base.NewUpdater.
+//	 LrSchedule	- The schedule of the learning rate. See base.NewLrSchedule.
+//	 FoldInEpochs	- The number of passes of SGD over ratings of a user in FoldIn. Default is 10.
 func NewSVD(params base.Params) *SVD {
 	svd := new(SVD)
 	svd.SetParams(params)
@@ -64,7 +72,9 @@ func (svd *SVD) SetParams(params base.Params) {
 	svd.reg = svd.Params.GetFloat64(base.Reg, 0.02)
 	svd.initMean = svd.Params.GetFloat64(base.InitMean, 0)
 	svd.initStdDev = svd.Params.GetFloat64(base.InitStdDev, 0.1)
+	svd.batchSize = svd.Params.GetInt(base.BatchSize, 1)
 	svd.target = svd.Params.GetString(base.Target, base.Regression)
+	svd.foldInEpochs = svd.Params.GetInt(base.FoldInEpochs, 10)
 }
 
 func (svd *SVD) Predict(userId int, itemId int) float64 {
@@ -73,7 +83,76 @@ func (svd *SVD) Predict(userId int, itemId int) float64 {
 	return svd.predict(denseUserId, denseItemId)
 }
 
+// Recommend recommends top-n items to a user.
+func (svd *SVD) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(svd, userId, n, svd.ItemIdSet.SparseIds, options...)
+}
+
+// PredictItems predicts ratings given by a user to a list of items.
+func (svd *SVD) PredictItems(userId int, itemIds []int) []float64 {
+	scores := make([]float64, len(itemIds))
+	if len(itemIds) == 0 {
+		return scores
+	}
+	denseUserId := svd.UserIdSet.ToDenseId(userId)
+	denseItemIds := svd.toDenseItemIds(itemIds)
+	// q_i^Tp_u
+	if denseUserId != base.NotId {
+		dotRows(scores, svd.ItemFactor, denseItemIds, svd.UserFactor[denseUserId])
+	}
+	// + μ + b_u + b_i
+	for i, denseItemId := range denseItemIds {
+		scores[i] += svd.bias(denseUserId, denseItemId)
+	}
+	return scores
+}
+
+// PredictAll predicts ratings given by a list of users to all items.
+func (svd *SVD) PredictAll(userIds []int) ([]int, *mat.Dense) {
+	itemIds := svd.ItemIdSet.SparseIds
+	if len(userIds) == 0 || len(itemIds) == 0 {
+		return itemIds, nil
+	}
+	denseUserIds := svd.toDenseUserIds(userIds)
+	// P Q^T
+	scores := mat.NewDense(len(userIds), len(itemIds), nil)
+	scores.Mul(factorRows(svd.UserFactor, denseUserIds, svd.nFactors),
+		svd.getItemMatrix(svd.ItemFactor, svd.nFactors).T())
+	// + μ + b_u + b_i
+	for i, denseUserId := range denseUserIds {
+		row := scores.RawRowView(i)
+		for denseItemId := range row {
+			row[denseItemId] += svd.bias(denseUserId, denseItemId)
+		}
+	}
+	return itemIds, scores
+}
+
+// SimilarItems returns top-n items most similar to an item by the cosine
+// similarity between item factors.
+func (svd *SVD) SimilarItems(itemId int, n int) ([]int, []float64) {
+	return similarFactors(&svd.ItemIdSet, svd.getItemMatrix(svd.ItemFactor, svd.nFactors), itemId, n)
+}
+
+// SimilarUsers returns top-n users most similar to a user by the cosine
+// similarity between user factors.
+func (svd *SVD) SimilarUsers(userId int, n int) ([]int, []float64) {
+	return similarFactors(&svd.UserIdSet, factorMatrix(svd.UserFactor, svd.nFactors), userId, n)
+}
+
 func (svd *SVD) predict(denseUserId int, denseItemId int) float64 {
+	ret := svd.bias(denseUserId, denseItemId)
+	// + q_i^Tp_u
+	if denseItemId != base.NotId && denseUserId != base.NotId {
+		userFactor := svd.UserFactor[denseUserId]
+		itemFactor := svd.ItemFactor[denseItemId]
+		ret += floats.Dot(userFactor, itemFactor)
+	}
+	return ret
+}
+
+// bias computes μ + b_u + b_i.
+func (svd *SVD) bias(denseUserId int, denseItemId int) float64 {
 	ret := svd.GlobalMean
 	// + b_u
 	if denseUserId != base.NotId {
@@ -83,12 +162,6 @@ func (svd *SVD) predict(denseUserId int, denseItemId int) float64 {
 	if denseItemId != base.NotId {
 		ret += svd.ItemBias[denseItemId]
 	}
-	// + q_i^Tp_u
-	if denseItemId != base.NotId && denseUserId != base.NotId {
-		userFactor := svd.UserFactor[denseUserId]
-		itemFactor := svd.ItemFactor[denseItemId]
-		ret += floats.Dot(userFactor, itemFactor)
-	}
 	return ret
 }
 
@@ -100,6 +173,7 @@ func (svd *SVD) Fit(trainSet core.DataSet, options ...base.FitOption) {
 	svd.ItemBias = make([]float64, trainSet.ItemCount())
 	svd.UserFactor = svd.rng.MakeNormalMatrix(trainSet.UserCount(), svd.nFactors, svd.initMean, svd.initStdDev)
 	svd.ItemFactor = svd.rng.MakeNormalMatrix(trainSet.ItemCount(), svd.nFactors, svd.initMean, svd.initStdDev)
+	svd.initUpdaters(svd.nEpochs)
 	// Select fit function
 	switch svd.target {
 	case base.Regression:
@@ -109,50 +183,207 @@ func (svd *SVD) Fit(trainSet core.DataSet, options ...base.FitOption) {
 	default:
 		panic(fmt.Sprintf("Unknown target: %v", svd.target))
 	}
+	svd.restoreBest(svd)
+}
+
+// initUpdaters creates updaters of parameters for nEpochs epochs.
+func (svd *SVD) initUpdaters(nEpochs int) {
+	svd.updaters = svd.newUpdaters(svd.lr, nEpochs)
+	svd.updaters.userFactor = svd.updaters.newUpdater(len(svd.UserFactor), svd.nFactors)
+	svd.updaters.itemFactor = svd.updaters.newUpdater(len(svd.ItemFactor), svd.nFactors)
+	svd.updaters.userBias = svd.updaters.newUpdater(len(svd.UserBias), 1)
+	svd.updaters.itemBias = svd.updaters.newUpdater(len(svd.ItemBias), 1)
 }
 
 func (svd *SVD) fitRegression(trainSet core.DataSet) {
 	svd.GlobalMean = trainSet.GlobalMean
+	if svd.batchSize > 1 {
+		svd.fitMiniBatch(trainSet)
+		return
+	}
 	// Create buffers
-	a := make([]float64, svd.nFactors)
-	b := make([]float64, svd.nFactors)
-	userFactor := make([]float64, svd.nFactors)
-	itemFactor := make([]float64, svd.nFactors)
-	// Optimize
-	for epoch := 0; epoch < svd.nEpochs; epoch++ {
+	buffers := newSGDBuffers(svd.rtOptions.NJobs, svd.nFactors)
+	// Optimize by SGD, or Hogwild SGD over shards of the permutation if enabled
+	for epoch := svd.resume(svd); epoch < svd.nEpochs && !svd.canceled(); epoch++ {
+		svd.updaters.setEpoch(epoch)
 		perm := svd.rng.Perm(trainSet.Len())
-		for _, i := range perm {
-			denseUserId, denseItemId, rating := trainSet.GetDense(i)
+		loss := svd.parallelLoss(svd.sgdJobs(), len(perm), func(jobId, begin, end int) float64 {
+			loss := 0.0
+			for _, i := range perm[begin:end] {
+				denseUserId, denseItemId, rating := trainSet.GetDense(i)
+				loss += svd.sgd(denseUserId, denseItemId, rating, buffers[jobId])
+			}
+			return loss
+		})
+		if svd.epochEnd(svd, epoch+1, loss/float64(trainSet.Len())) {
+			break
+		}
+	}
+}
+
+// fitMiniBatch optimizes by mini-batch SGD. Gradients of ratings in a batch are
+// computed in parallel and summed up (not averaged), then each parameter is
+// updated by the optimizer once per batch.
+func (svd *SVD) fitMiniBatch(trainSet core.DataSet) {
+	// Create gradients
+	userGrads := newGradients(svd.rtOptions.NJobs)
+	itemGrads := newGradients(svd.rtOptions.NJobs)
+	for epoch := svd.resume(svd); epoch < svd.nEpochs && !svd.canceled(); epoch++ {
+		svd.updaters.setEpoch(epoch)
+		loss := 0.0
+		perm := svd.rng.Perm(trainSet.Len())
+		for low := 0; low < len(perm); low += svd.batchSize {
+			high := low + svd.batchSize
+			if high > len(perm) {
+				high = len(perm)
+			}
+			batch := perm[low:high]
+			loss += svd.parallelLoss(svd.rtOptions.NJobs, len(batch), func(jobId, begin, end int) float64 {
+				userGrad, itemGrad := userGrads[jobId], itemGrads[jobId]
+				loss := 0.0
+				for _, i := range batch[begin:end] {
+					denseUserId, denseItemId, rating := trainSet.GetDense(i)
+					userFactor, itemFactor := svd.UserFactor[denseUserId], svd.ItemFactor[denseItemId]
+					// Compute error: e_{ui} = r - \hat r
+					upGrad := rating - svd.predict(denseUserId, denseItemId)
+					loss += upGrad * upGrad
+					if svd.useBias {
+						// Accumulate gradients of biases: e_{ui} - \lambda b
+						userGrad.addBias(denseUserId, upGrad-svd.reg*svd.UserBias[denseUserId])
+						itemGrad.addBias(denseItemId, upGrad-svd.reg*svd.ItemBias[denseItemId])
+					}
+					// Accumulate gradient of user latent factor: e_{ui} q_i - \lambda p_u
+					userGrad.addFactor(denseUserId, upGrad, itemFactor)
+					userGrad.addFactor(denseUserId, -svd.reg, userFactor)
+					// Accumulate gradient of item latent factor: e_{ui} p_u - \lambda q_i
+					itemGrad.addFactor(denseItemId, upGrad, userFactor)
+					itemGrad.addFactor(denseItemId, -svd.reg, itemFactor)
+				}
+				return loss
+			})
+			// Sum up gradients of jobs and update parameters
+			userGrads[0].merge(userGrads[1:])
+			itemGrads[0].merge(itemGrads[1:])
+			userGrads[0].apply(svd.updaters.userFactor, svd.UserFactor, svd.updaters.userBias, svd.UserBias)
+			itemGrads[0].apply(svd.updaters.itemFactor, svd.ItemFactor, svd.updaters.itemBias, svd.ItemBias)
+		}
+		if svd.epochEnd(svd, epoch+1, loss/float64(trainSet.Len())) {
+			break
+		}
+	}
+}
+
+// sgd updates parameters by a rating and returns the squared error.
+func (svd *SVD) sgd(denseUserId, denseItemId int, rating float64, buffer *sgdBuffer) float64 {
+	a, b := buffer.a, buffer.b
+	userFactor, itemFactor := buffer.userFactor, buffer.itemFactor
+	// Compute error: e_{ui} = r - \hat r
+	upGrad := rating - svd.predict(denseUserId, denseItemId)
+	if svd.useBias {
+		userBias := svd.UserBias[denseUserId]
+		itemBias := svd.ItemBias[denseItemId]
+		// Update user Bias: b_u <- b_u + \gamma (e_{ui} - \lambda b_u)
+		buffer.bias[0] = upGrad - svd.reg*userBias
+		svd.updaters.userBias.Update(denseUserId, svd.UserBias[denseUserId:denseUserId+1], buffer.bias)
+		// Update item Bias: p_i <- p_i + \gamma (e_{ui} - \lambda b_i)
+		buffer.bias[0] = upGrad - svd.reg*itemBias
+		svd.updaters.itemBias.Update(denseItemId, svd.ItemBias[denseItemId:denseItemId+1], buffer.bias)
+	}
+	copy(userFactor, svd.UserFactor[denseUserId])
+	copy(itemFactor, svd.ItemFactor[denseItemId])
+	// Update user latent factor
+	copy(a, itemFactor)
+	base.MulConst(upGrad, a)
+	copy(b, userFactor)
+	base.MulConst(svd.reg, b)
+	floats.Sub(a, b)
+	svd.updaters.userFactor.Update(denseUserId, svd.UserFactor[denseUserId], a)
+	// Update item latent factor
+	copy(a, userFactor)
+	base.MulConst(upGrad, a)
+	copy(b, itemFactor)
+	base.MulConst(svd.reg, b)
+	floats.Sub(a, b)
+	svd.updaters.itemFactor.Update(denseItemId, svd.ItemFactor[denseItemId], a)
+	return upGrad * upGrad
+}
+
+// PartialFit updates the model with new ratings by nEpochs passes of SGD. Unseen
+// users and items are added with random factors and zero biases. Optimizers
+// start from fresh states in each call, where the learning rate is scheduled
+// over nEpochs. Only the regression target is supported.
+func (svd *SVD) PartialFit(table core.Table, nEpochs int, options ...base.FitOption) {
+	if svd.target != base.Regression {
+		panic(fmt.Sprintf("PartialFit() doesn't support target: %v", svd.target))
+	}
+	denseUserIds, denseItemIds, ratings := svd.partialInit(table, options)
+	// Initialize new users and items
+	for len(svd.UserFactor) < svd.UserIdSet.Len() {
+		svd.UserFactor = append(svd.UserFactor, svd.rng.MakeNormalVector(svd.nFactors, svd.initMean, svd.initStdDev))
+		svd.UserBias = append(svd.UserBias, 0)
+	}
+	for len(svd.ItemFactor) < svd.ItemIdSet.Len() {
+		svd.ItemFactor = append(svd.ItemFactor, svd.rng.MakeNormalVector(svd.nFactors, svd.initMean, svd.initStdDev))
+		svd.ItemBias = append(svd.ItemBias, 0)
+	}
+	// Stochastic Gradient Descent
+	svd.initUpdaters(nEpochs)
+	buffers := newSGDBuffers(svd.rtOptions.NJobs, svd.nFactors)
+	for epoch := 0; epoch < nEpochs && !svd.canceled(); epoch++ {
+		svd.updaters.setEpoch(epoch)
+		perm := svd.rng.Perm(len(ratings))
+		loss := svd.parallelLoss(svd.sgdJobs(), len(perm), func(jobId, begin, end int) float64 {
+			loss := 0.0
+			for _, i := range perm[begin:end] {
+				loss += svd.sgd(denseUserIds[i], denseItemIds[i], ratings[i], buffers[jobId])
+			}
+			return loss
+		})
+		if svd.epochEnd(svd, epoch+1, loss/float64(len(ratings))) {
+			break
+		}
+	}
+	svd.restoreBest(svd)
+}
+
+// FoldIn solves the latent factor and the bias of a user by FoldInEpochs passes
+// of SGD over the user's ratings, where item factors and biases are fixed. The
+// user starts from zeros even if it exists, and it's updated by the optimizer
+// and the schedule of the model. Only the regression target is supported.
+func (svd *SVD) FoldIn(userId int, itemIds []int, ratings []float64) {
+	if svd.target != base.Regression {
+		panic(fmt.Sprintf("FoldIn() doesn't support target: %v", svd.target))
+	}
+	denseUserId, denseItemIds, ratings := svd.foldInUser(userId, itemIds, ratings)
+	if denseUserId == len(svd.UserFactor) {
+		svd.UserFactor = append(svd.UserFactor, make([]float64, svd.nFactors))
+		svd.UserBias = append(svd.UserBias, 0)
+	} else {
+		base.FillZeroVector(svd.UserFactor[denseUserId])
+		svd.UserBias[denseUserId] = 0
+	}
+	userFactor := svd.UserFactor[denseUserId]
+	userBias := svd.UserBias[denseUserId : denseUserId+1]
+	// Optimizers of the user
+	updaters := svd.newUpdaters(svd.lr, svd.foldInEpochs)
+	factorUpdater := updaters.newUpdater(1, svd.nFactors)
+	biasUpdater := updaters.newUpdater(1, 1)
+	grad, biasGrad := make([]float64, svd.nFactors), make([]float64, 1)
+	for epoch := 0; epoch < svd.foldInEpochs; epoch++ {
+		updaters.setEpoch(epoch)
+		for i, denseItemId := range denseItemIds {
 			// Compute error: e_{ui} = r - \hat r
-			upGrad := rating - svd.predict(denseUserId, denseItemId)
+			upGrad := ratings[i] - svd.predict(denseUserId, denseItemId)
 			if svd.useBias {
-				userBias := svd.UserBias[denseUserId]
-				itemBias := svd.ItemBias[denseItemId]
 				// Update user Bias: b_u <- b_u + \gamma (e_{ui} - \lambda b_u)
-				gradUserBias := upGrad - svd.reg*userBias
-				svd.UserBias[denseUserId] += svd.lr * gradUserBias
-				// Update item Bias: p_i <- p_i + \gamma (e_{ui} - \lambda b_i)
-				gradItemBias := upGrad - svd.reg*itemBias
-				svd.ItemBias[denseItemId] += svd.lr * gradItemBias
+				biasGrad[0] = upGrad - svd.reg*userBias[0]
+				biasUpdater.Update(0, userBias, biasGrad)
 			}
-			copy(userFactor, svd.UserFactor[denseUserId])
-			copy(itemFactor, svd.ItemFactor[denseItemId])
-			// Update user latent factor
-			copy(a, itemFactor)
-			base.MulConst(upGrad, a)
-			copy(b, userFactor)
-			base.MulConst(svd.reg, b)
-			floats.Sub(a, b)
-			base.MulConst(svd.lr, a)
-			floats.Add(svd.UserFactor[denseUserId], a)
-			// Update item latent factor
-			copy(a, userFactor)
-			base.MulConst(upGrad, a)
-			copy(b, itemFactor)
-			base.MulConst(svd.reg, b)
-			floats.Sub(a, b)
-			base.MulConst(svd.lr, a)
-			floats.Add(svd.ItemFactor[denseItemId], a)
+			// Update user latent factor: p_u <- p_u + \gamma (e_{ui} q_i - \lambda p_u)
+			copy(grad, svd.ItemFactor[denseItemId])
+			base.MulConst(upGrad, grad)
+			floats.AddScaled(grad, -svd.reg, userFactor)
+			factorUpdater.Update(0, userFactor, grad)
 		}
 	}
 }
@@ -167,63 +398,178 @@ func (svd *SVD) fitBPR(trainSet core.DataSet) {
 		})
 	}
 	// Create buffers
-	a := make([]float64, svd.nFactors)
-	b := make([]float64, svd.nFactors)
-	userFactor := make([]float64, svd.nFactors)
-	positiveItemFactor := make([]float64, svd.nFactors)
-	negativeItemFactor := make([]float64, svd.nFactors)
-	// Training
-	for epoch := 0; epoch < svd.nEpochs; epoch++ {
-		// Training epoch
-		for i := 0; i < trainSet.Len(); i++ {
-			// Select a user
-			denseUserId := svd.rng.Intn(trainSet.UserCount())
-			densePosId := trainSet.DenseUserRatings[denseUserId].Indices[svd.rng.Intn(trainSet.DenseUserRatings[denseUserId].Len())]
-			// Select a negative sample
-			denseNegId := -1
-			for {
-				temp := svd.rng.Intn(trainSet.ItemCount())
-				if _, exist := positiveSet[denseUserId][temp]; !exist {
-					denseNegId = temp
-					break
+	buffers := newSGDBuffers(svd.rtOptions.NJobs, svd.nFactors)
+	rngs := make([]base.RandomGenerator, svd.sgdJobs())
+	// Training by SGD, where each Hogwild job samples by its own generator
+	for epoch := svd.resume(svd); epoch < svd.nEpochs && !svd.canceled(); epoch++ {
+		svd.updaters.setEpoch(epoch)
+		for j := range rngs {
+			rngs[j] = base.NewRandomGenerator(svd.rng.Int63())
+		}
+		loss := svd.parallelLoss(svd.sgdJobs(), trainSet.Len(), func(jobId, begin, end int) float64 {
+			rng := rngs[jobId]
+			loss := 0.0
+			for i := begin; i < end; i++ {
+				// Select a user
+				denseUserId := rng.Intn(trainSet.UserCount())
+				densePosId := trainSet.DenseUserRatings[denseUserId].Indices[rng.Intn(trainSet.DenseUserRatings[denseUserId].Len())]
+				// Select a negative sample
+				denseNegId := -1
+				for {
+					temp := rng.Intn(trainSet.ItemCount())
+					if _, exist := positiveSet[denseUserId][temp]; !exist {
+						denseNegId = temp
+						break
+					}
 				}
+				loss += svd.bpr(denseUserId, densePosId, denseNegId, buffers[jobId])
 			}
-			diff := svd.predict(denseUserId, densePosId) - svd.predict(denseUserId, denseNegId)
-			grad := math.Exp(-diff) / (1.0 + math.Exp(-diff))
-			// Pairwise update
-			copy(userFactor, svd.UserFactor[denseUserId])
-			copy(positiveItemFactor, svd.ItemFactor[densePosId])
-			copy(negativeItemFactor, svd.ItemFactor[denseNegId])
-			// Update positive item latent factor: +w_u
-			copy(a, userFactor)
-			base.MulConst(grad, a)
-			copy(b, positiveItemFactor)
-			base.MulConst(svd.reg, b)
-			floats.Sub(a, b)
-			base.MulConst(svd.lr, a)
-			floats.Add(svd.ItemFactor[densePosId], a)
-			// Update negative item latent factor: -w_u
-			copy(a, userFactor)
-			base.Neg(a)
-			base.MulConst(grad, a)
-			copy(b, negativeItemFactor)
-			base.MulConst(svd.reg, b)
-			floats.Sub(a, b)
-			base.MulConst(svd.lr, a)
-			floats.Add(svd.ItemFactor[denseNegId], a)
-			// Update user latent factor: h_i-h_j
-			copy(a, positiveItemFactor)
-			floats.Sub(a, negativeItemFactor)
-			base.MulConst(grad, a)
-			copy(b, userFactor)
-			base.MulConst(svd.reg, b)
-			floats.Sub(a, b)
-			base.MulConst(svd.lr, a)
-			floats.Add(svd.UserFactor[denseUserId], a)
+			return loss
+		})
+		if svd.epochEnd(svd, epoch+1, loss/float64(trainSet.Len())) {
+			break
 		}
 	}
 }
 
+// bpr updates parameters by a user, a positive item and a negative item, and
+// returns the loss.
+func (svd *SVD) bpr(denseUserId, densePosId, denseNegId int, buffer *sgdBuffer) float64 {
+	a, b := buffer.a, buffer.b
+	userFactor, positiveItemFactor, negativeItemFactor := buffer.userFactor, buffer.itemFactor, buffer.negativeItemFactor
+	diff := svd.predict(denseUserId, densePosId) - svd.predict(denseUserId, denseNegId)
+	grad := math.Exp(-diff) / (1.0 + math.Exp(-diff))
+	// Pairwise update
+	copy(userFactor, svd.UserFactor[denseUserId])
+	copy(positiveItemFactor, svd.ItemFactor[densePosId])
+	copy(negativeItemFactor, svd.ItemFactor[denseNegId])
+	// Update positive item latent factor: +w_u
+	copy(a, userFactor)
+	base.MulConst(grad, a)
+	copy(b, positiveItemFactor)
+	base.MulConst(svd.reg, b)
+	floats.Sub(a, b)
+	svd.updaters.itemFactor.Update(densePosId, svd.ItemFactor[densePosId], a)
+	// Update negative item latent factor: -w_u
+	copy(a, userFactor)
+	base.Neg(a)
+	base.MulConst(grad, a)
+	copy(b, negativeItemFactor)
+	base.MulConst(svd.reg, b)
+	floats.Sub(a, b)
+	svd.updaters.itemFactor.Update(denseNegId, svd.ItemFactor[denseNegId], a)
+	// Update user latent factor: h_i-h_j
+	copy(a, positiveItemFactor)
+	floats.Sub(a, negativeItemFactor)
+	base.MulConst(grad, a)
+	copy(b, userFactor)
+	base.MulConst(svd.reg, b)
+	floats.Sub(a, b)
+	svd.updaters.userFactor.Update(denseUserId, svd.UserFactor[denseUserId], a)
+	// -\ln \sigma(\hat{x}_{uij})
+	return math.Log1p(math.Exp(-diff))
+}
+
+// sgdBuffer contains buffers used in SGD. Each job owns a buffer in Hogwild SGD.
+type sgdBuffer struct {
+	a                  []float64
+	b                  []float64
+	userFactor         []float64
+	itemFactor         []float64
+	negativeItemFactor []float64
+	bias               []float64
+}
+
+func newSGDBuffer(nFactors int) *sgdBuffer {
+	return &sgdBuffer{
+		a:                  make([]float64, nFactors),
+		b:                  make([]float64, nFactors),
+		userFactor:         make([]float64, nFactors),
+		itemFactor:         make([]float64, nFactors),
+		negativeItemFactor: make([]float64, nFactors),
+		bias:               make([]float64, 1),
+	}
+}
+
+func newSGDBuffers(nJobs, nFactors int) []*sgdBuffer {
+	buffers := make([]*sgdBuffer, nJobs)
+	for i := range buffers {
+		buffers[i] = newSGDBuffer(nFactors)
+	}
+	return buffers
+}
+
+// gradients accumulates gradients of latent factors and biases by dense IDs.
+// Each job owns gradients in mini-batch SGD.
+type gradients struct {
+	factors map[int][]float64
+	biases  map[int]float64
+	pool    [][]float64
+	bias    []float64
+}
+
+func newGradients(nJobs int) []*gradients {
+	grads := make([]*gradients, nJobs)
+	for i := range grads {
+		grads[i] = &gradients{
+			factors: make(map[int][]float64),
+			biases:  make(map[int]float64),
+			bias:    make([]float64, 1),
+		}
+	}
+	return grads
+}
+
+// addFactor adds scale * x to the gradient of a latent factor.
+func (grads *gradients) addFactor(denseId int, scale float64, x []float64) {
+	grad, exist := grads.factors[denseId]
+	if !exist {
+		if n := len(grads.pool); n > 0 {
+			grad, grads.pool = grads.pool[n-1], grads.pool[:n-1]
+		} else {
+			grad = make([]float64, len(x))
+		}
+		grads.factors[denseId] = grad
+	}
+	floats.AddScaled(grad, scale, x)
+}
+
+// addBias adds value to the gradient of a bias.
+func (grads *gradients) addBias(denseId int, value float64) {
+	grads.biases[denseId] += value
+}
+
+// merge adds gradients of other jobs in order, then other gradients are cleared.
+func (grads *gradients) merge(others []*gradients) {
+	for _, other := range others {
+		for denseId, grad := range other.factors {
+			grads.addFactor(denseId, 1, grad)
+			base.FillZeroVector(grad)
+			other.pool = append(other.pool, grad)
+			delete(other.factors, denseId)
+		}
+		for denseId, grad := range other.biases {
+			grads.addBias(denseId, grad)
+			delete(other.biases, denseId)
+		}
+	}
+}
+
+// apply updates latent factors and biases by gradients, then gradients are cleared.
+func (grads *gradients) apply(factorUpdater base.Updater, factors [][]float64, biasUpdater base.Updater, biases []float64) {
+	for denseId, grad := range grads.factors {
+		factorUpdater.Update(denseId, factors[denseId], grad)
+		base.FillZeroVector(grad)
+		grads.pool = append(grads.pool, grad)
+		delete(grads.factors, denseId)
+	}
+	for denseId, grad := range grads.biases {
+		grads.bias[0] = grad
+		biasUpdater.Update(denseId, biases[denseId:denseId+1], grads.bias)
+		delete(grads.biases, denseId)
+	}
+}
+
 /* NMF */
 
 // NMF: Non-negative Matrix Factorization[3].
@@ -267,6 +613,63 @@ func (nmf *NMF) Predict(userId int, itemId int) float64 {
 	return nmf.predict(denseUserId, denseItemId)
 }
 
+// Recommend recommends top-n items to a user.
+func (nmf *NMF) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(nmf, userId, n, nmf.ItemIdSet.SparseIds, options...)
+}
+
+// PredictItems predicts ratings given by a user to a list of items.
+func (nmf *NMF) PredictItems(userId int, itemIds []int) []float64 {
+	scores := make([]float64, len(itemIds))
+	if len(itemIds) == 0 {
+		return scores
+	}
+	denseUserId := nmf.UserIdSet.ToDenseId(userId)
+	denseItemIds := nmf.toDenseItemIds(itemIds)
+	if denseUserId != base.NotId {
+		dotRows(scores, nmf.ItemFactor, denseItemIds, nmf.UserFactor[denseUserId])
+	}
+	for i, denseItemId := range denseItemIds {
+		if denseUserId == base.NotId || denseItemId == base.NotId {
+			scores[i] = nmf.GlobalMean
+		}
+	}
+	return scores
+}
+
+// PredictAll predicts ratings given by a list of users to all items.
+func (nmf *NMF) PredictAll(userIds []int) ([]int, *mat.Dense) {
+	itemIds := nmf.ItemIdSet.SparseIds
+	if len(userIds) == 0 || len(itemIds) == 0 {
+		return itemIds, nil
+	}
+	denseUserIds := nmf.toDenseUserIds(userIds)
+	scores := mat.NewDense(len(userIds), len(itemIds), nil)
+	scores.Mul(factorRows(nmf.UserFactor, denseUserIds, nmf.nFactors),
+		nmf.getItemMatrix(nmf.ItemFactor, nmf.nFactors).T())
+	for i, denseUserId := range denseUserIds {
+		if denseUserId == base.NotId {
+			row := scores.RawRowView(i)
+			for j := range row {
+				row[j] = nmf.GlobalMean
+			}
+		}
+	}
+	return itemIds, scores
+}
+
+// SimilarItems returns top-n items most similar to an item by the cosine
+// similarity between item factors.
+func (nmf *NMF) SimilarItems(itemId int, n int) ([]int, []float64) {
+	return similarFactors(&nmf.ItemIdSet, nmf.getItemMatrix(nmf.ItemFactor, nmf.nFactors), itemId, n)
+}
+
+// SimilarUsers returns top-n users most similar to a user by the cosine
+// similarity between user factors.
+func (nmf *NMF) SimilarUsers(userId int, n int) ([]int, []float64) {
+	return similarFactors(&nmf.UserIdSet, factorMatrix(nmf.UserFactor, nmf.nFactors), userId, n)
+}
+
 func (nmf *NMF) predict(denseUserId int, denseItemId int) float64 {
 	if denseItemId != base.NotId && denseUserId != base.NotId {
 		return floats.Dot(nmf.UserFactor[denseUserId], nmf.ItemFactor[denseItemId])
@@ -281,58 +684,83 @@ func (nmf *NMF) Fit(trainSet core.DataSet, options ...base.FitOption) {
 	nmf.UserFactor = nmf.rng.MakeUniformMatrix(trainSet.UserCount(), nmf.nFactors, nmf.initLow, nmf.initHigh)
 	nmf.ItemFactor = nmf.rng.MakeUniformMatrix(trainSet.ItemCount(), nmf.nFactors, nmf.initLow, nmf.initHigh)
 	// Create intermediate matrix buffer
-	buffer := make([]float64, nmf.nFactors)
 	userNum := base.MakeMatrix(trainSet.UserCount(), nmf.nFactors)
 	userDen := base.MakeMatrix(trainSet.UserCount(), nmf.nFactors)
 	itemNum := base.MakeMatrix(trainSet.ItemCount(), nmf.nFactors)
 	itemDen := base.MakeMatrix(trainSet.ItemCount(), nmf.nFactors)
-	// Stochastic Gradient Descent
-	for epoch := 0; epoch < nmf.nEpochs; epoch++ {
+	// Stochastic Gradient Descent, where users and items are updated in parallel
+	for epoch := nmf.resume(nmf); epoch < nmf.nEpochs && !nmf.canceled(); epoch++ {
 		// Reset intermediate matrices
 		base.FillZeroMatrix(userNum)
 		base.FillZeroMatrix(userDen)
 		base.FillZeroMatrix(itemNum)
 		base.FillZeroMatrix(itemDen)
-		// Calculate intermediate matrices
-		for i := 0; i < trainSet.Len(); i++ {
-			denseUserId, denseItemId, rating := trainSet.GetDense(i)
-			prediction := nmf.predict(denseUserId, denseItemId)
-			// Update \sum_{i\in{I_u}} q_{if}⋅r_{ui}
-			copy(buffer, nmf.ItemFactor[denseItemId])
-			base.MulConst(rating, buffer)
-			floats.Add(userNum[denseUserId], buffer)
-			// Update \sum_{i\in{I_u}} q_{if}⋅\hat{r}_{ui} + \lambda|I_u|p_{uf}
-			copy(buffer, nmf.ItemFactor[denseItemId])
-			base.MulConst(prediction, buffer)
-			floats.Add(userDen[denseUserId], buffer)
-			copy(buffer, nmf.UserFactor[denseUserId])
-			base.MulConst(nmf.reg, buffer)
-			floats.Add(userDen[denseUserId], buffer)
-			// Update \sum_{u\in{U_i}}p_{uf}⋅r_{ui}
-			copy(buffer, nmf.UserFactor[denseUserId])
-			base.MulConst(rating, buffer)
-			floats.Add(itemNum[denseItemId], buffer)
-			// Update \sum_{u\in{U_i}}p_{uf}⋅\hat{r}_{ui} + \lambda|U_i|q_{if}
-			copy(buffer, nmf.UserFactor[denseUserId])
-			base.MulConst(prediction, buffer)
-			floats.Add(itemDen[denseItemId], buffer)
-			copy(buffer, nmf.ItemFactor[denseItemId])
-			base.MulConst(nmf.reg, buffer)
-			floats.Add(itemDen[denseItemId], buffer)
-		}
+		// Calculate intermediate matrices of users
+		loss := nmf.parallelLoss(nmf.rtOptions.NJobs, trainSet.UserCount(), func(_, begin, end int) float64 {
+			buffer := make([]float64, nmf.nFactors)
+			loss := 0.0
+			for denseUserId := begin; denseUserId < end; denseUserId++ {
+				trainSet.DenseUserRatings[denseUserId].ForEach(func(_, denseItemId int, rating float64) {
+					prediction := nmf.predict(denseUserId, denseItemId)
+					loss += (rating - prediction) * (rating - prediction)
+					// Update \sum_{i\in{I_u}} q_{if}⋅r_{ui}
+					copy(buffer, nmf.ItemFactor[denseItemId])
+					base.MulConst(rating, buffer)
+					floats.Add(userNum[denseUserId], buffer)
+					// Update \sum_{i\in{I_u}} q_{if}⋅\hat{r}_{ui} + \lambda|I_u|p_{uf}
+					copy(buffer, nmf.ItemFactor[denseItemId])
+					base.MulConst(prediction, buffer)
+					floats.Add(userDen[denseUserId], buffer)
+					copy(buffer, nmf.UserFactor[denseUserId])
+					base.MulConst(nmf.reg, buffer)
+					floats.Add(userDen[denseUserId], buffer)
+				})
+			}
+			return loss
+		})
+		// Calculate intermediate matrices of items
+		base.Parallel(trainSet.ItemCount(), nmf.rtOptions.NJobs, func(begin, end int) {
+			buffer := make([]float64, nmf.nFactors)
+			for denseItemId := begin; denseItemId < end; denseItemId++ {
+				trainSet.DenseItemRatings[denseItemId].ForEach(func(_, denseUserId int, rating float64) {
+					prediction := nmf.predict(denseUserId, denseItemId)
+					// Update \sum_{u\in{U_i}}p_{uf}⋅r_{ui}
+					copy(buffer, nmf.UserFactor[denseUserId])
+					base.MulConst(rating, buffer)
+					floats.Add(itemNum[denseItemId], buffer)
+					// Update \sum_{u\in{U_i}}p_{uf}⋅\hat{r}_{ui} + \lambda|U_i|q_{if}
+					copy(buffer, nmf.UserFactor[denseUserId])
+					base.MulConst(prediction, buffer)
+					floats.Add(itemDen[denseItemId], buffer)
+					copy(buffer, nmf.ItemFactor[denseItemId])
+					base.MulConst(nmf.reg, buffer)
+					floats.Add(itemDen[denseItemId], buffer)
+				})
+			}
+		})
 		// Update user factors
-		for u := range nmf.UserFactor {
-			copy(buffer, userNum[u])
-			floats.Div(buffer, userDen[u])
-			floats.Mul(nmf.UserFactor[u], buffer)
-		}
+		base.Parallel(trainSet.UserCount(), nmf.rtOptions.NJobs, func(begin, end int) {
+			buffer := make([]float64, nmf.nFactors)
+			for u := begin; u < end; u++ {
+				copy(buffer, userNum[u])
+				floats.Div(buffer, userDen[u])
+				floats.Mul(nmf.UserFactor[u], buffer)
+			}
+		})
 		// Update item factors
-		for i := range nmf.ItemFactor {
-			copy(buffer, itemNum[i])
-			floats.Div(buffer, itemDen[i])
-			floats.Mul(nmf.ItemFactor[i], buffer)
+		base.Parallel(trainSet.ItemCount(), nmf.rtOptions.NJobs, func(begin, end int) {
+			buffer := make([]float64, nmf.nFactors)
+			for i := begin; i < end; i++ {
+				copy(buffer, itemNum[i])
+				floats.Div(buffer, itemDen[i])
+				floats.Mul(nmf.ItemFactor[i], buffer)
+			}
+		})
+		if nmf.epochEnd(nmf, epoch+1, loss/float64(trainSet.Len())) {
+			break
 		}
 	}
+	nmf.restoreBest(nmf)
 }
 
 /* SVD++ */
@@ -362,9 +790,11 @@ type SVDpp struct {
 	lr          float64
 	initMean    float64
 	initStdDev  float64
+	batchSize   int
 }
 
 // NewSVDpp creates a SVD++ model. Params:
+//
 //	 Reg 		- The regularization parameter of the cost function that is
 // 				  optimized. Default is 0.02.
 //	 Lr 		- The learning rate of SGD. Default is 0.007.
@@ -372,6 +802,10 @@ type SVDpp struct {
 //	 NEpochs	- The number of iteration of the SGD procedure. Default is 20.
 //	 InitMean	- The mean of initial random latent factors. Default is 0.
 //	 InitStdDev	- The standard deviation of initial random latent factors. Default is 0.1.
+//	 BatchSize	- The number of users in a mini-batch. Default is 1, which means SGD
+//				  without mini-batches. Gradients in a batch are summed up, not averaged.
+//	 Optimizer	- The optimizer of latent factors and biases. See base.NewUpdater.
+//	 LrSchedule	- The schedule of the learning rate. See base.NewLrSchedule.
 func NewSVDpp(params base.Params) *SVDpp {
 	svd := new(SVDpp)
 	svd.SetParams(params)
@@ -387,6 +821,7 @@ func (svd *SVDpp) SetParams(params base.Params) {
 	svd.reg = svd.Params.GetFloat64(base.Reg, 0.02)
 	svd.initMean = svd.Params.GetFloat64(base.InitMean, 0)
 	svd.initStdDev = svd.Params.GetFloat64(base.InitStdDev, 0.1)
+	svd.batchSize = svd.Params.GetInt(base.BatchSize, 1)
 }
 
 func (svd *SVDpp) Predict(userId int, itemId int) float64 {
@@ -396,16 +831,58 @@ func (svd *SVDpp) Predict(userId int, itemId int) float64 {
 	return ret
 }
 
-func (svd *SVDpp) predict(denseUserId int, denseItemId int, sumFactor []float64) float64 {
-	ret := svd.GlobalMean
-	// + b_u
+// Recommend recommends top-n items to a user.
+func (svd *SVDpp) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(svd, userId, n, svd.ItemIdSet.SparseIds, options...)
+}
+
+// PredictItems predicts ratings given by a user to a list of items.
+func (svd *SVDpp) PredictItems(userId int, itemIds []int) []float64 {
+	scores := make([]float64, len(itemIds))
+	if len(itemIds) == 0 {
+		return scores
+	}
+	denseUserId := svd.UserIdSet.ToDenseId(userId)
+	denseItemIds := svd.toDenseItemIds(itemIds)
+	// q_i^T\left(p_u + |I_u|^{-\frac{1}{2}} \sum_{j \in I_u}y_j\right)
 	if denseUserId != base.NotId {
-		ret += svd.UserBias[denseUserId]
+		dotRows(scores, svd.ItemFactor, denseItemIds, svd.getUserVector(denseUserId))
 	}
-	// + b_i
-	if denseItemId != base.NotId {
-		ret += svd.ItemBias[denseItemId]
+	// + μ + b_u + b_i
+	for i, denseItemId := range denseItemIds {
+		scores[i] += svd.bias(denseUserId, denseItemId)
+	}
+	return scores
+}
+
+// PredictAll predicts ratings given by a list of users to all items.
+func (svd *SVDpp) PredictAll(userIds []int) ([]int, *mat.Dense) {
+	itemIds := svd.ItemIdSet.SparseIds
+	if len(userIds) == 0 || len(itemIds) == 0 {
+		return itemIds, nil
+	}
+	denseUserIds := svd.toDenseUserIds(userIds)
+	// Stack p_u + |I_u|^{-\frac{1}{2}} \sum_{j \in I_u}y_j
+	userVectors := mat.NewDense(len(userIds), svd.nFactors, nil)
+	for i, denseUserId := range denseUserIds {
+		if denseUserId != base.NotId {
+			userVectors.SetRow(i, svd.getUserVector(denseUserId))
+		}
+	}
+	scores := mat.NewDense(len(userIds), len(itemIds), nil)
+	scores.Mul(userVectors, svd.getItemMatrix(svd.ItemFactor, svd.nFactors).T())
+	// + μ + b_u + b_i
+	for i, denseUserId := range denseUserIds {
+		row := scores.RawRowView(i)
+		for denseItemId := range row {
+			row[denseItemId] += svd.bias(denseUserId, denseItemId)
+		}
 	}
+	return itemIds, scores
+}
+
+func (svd *SVDpp) predict(denseUserId int, denseItemId int, sumFactor []float64) float64 {
+	ret := svd.bias(denseUserId, denseItemId)
 	// + q_i^T\left(p_u + |I_u|^{-\frac{1}{2}} \sum_{j \in I_u}y_j\right)
 	if denseItemId != base.NotId && denseUserId != base.NotId {
 		userFactor := svd.UserFactor[denseUserId]
@@ -421,6 +898,27 @@ func (svd *SVDpp) predict(denseUserId int, denseItemId int, sumFactor []float64)
 	return ret
 }
 
+// bias computes μ + b_u + b_i.
+func (svd *SVDpp) bias(denseUserId int, denseItemId int) float64 {
+	ret := svd.GlobalMean
+	// + b_u
+	if denseUserId != base.NotId {
+		ret += svd.UserBias[denseUserId]
+	}
+	// + b_i
+	if denseItemId != base.NotId {
+		ret += svd.ItemBias[denseItemId]
+	}
+	return ret
+}
+
+// getUserVector computes p_u + |I_u|^{-\frac{1}{2}} \sum_{j \in I_u}y_j.
+func (svd *SVDpp) getUserVector(denseUserId int) []float64 {
+	userVector := svd.getSumFactors(denseUserId)
+	floats.Add(userVector, svd.UserFactor[denseUserId])
+	return userVector
+}
+
 func (svd *SVDpp) getSumFactors(denseUserId int) []float64 {
 	sumFactor := make([]float64, svd.nFactors)
 	// User history exists
@@ -443,89 +941,244 @@ func (svd *SVDpp) Fit(trainSet core.DataSet, setters ...base.FitOption) {
 	svd.ImplFactor = svd.rng.MakeNormalMatrix(trainSet.ItemCount(), svd.nFactors, svd.initMean, svd.initStdDev)
 	// Build user rating set
 	svd.UserRatings = trainSet.DenseUserRatings
+	svd.initUpdaters(svd.nEpochs)
+	// Select fit function
+	if svd.batchSize > 1 {
+		svd.fitMiniBatch(trainSet)
+	} else {
+		svd.fitSGD(trainSet)
+	}
+	svd.restoreBest(svd)
+}
+
+// initUpdaters creates updaters of parameters for nEpochs epochs.
+func (svd *SVDpp) initUpdaters(nEpochs int) {
+	svd.updaters = svd.newUpdaters(svd.lr, nEpochs)
+	svd.updaters.userFactor = svd.updaters.newUpdater(len(svd.UserFactor), svd.nFactors)
+	svd.updaters.itemFactor = svd.updaters.newUpdater(len(svd.ItemFactor), svd.nFactors)
+	svd.updaters.implFactor = svd.updaters.newUpdater(len(svd.ImplFactor), svd.nFactors)
+	svd.updaters.userBias = svd.updaters.newUpdater(len(svd.UserBias), 1)
+	svd.updaters.itemBias = svd.updaters.newUpdater(len(svd.ItemBias), 1)
+}
+
+func (svd *SVDpp) fitSGD(trainSet core.DataSet) {
 	// Create buffers
-	a := make([]float64, svd.nFactors)
-	b := make([]float64, svd.nFactors)
-	step := make([]float64, svd.nFactors)
-	userFactor := make([]float64, svd.nFactors)
-	itemFactor := make([]float64, svd.nFactors)
-	c := base.MakeMatrix(svd.rtOptions.NJobs, svd.nFactors)
-	d := base.MakeMatrix(svd.rtOptions.NJobs, svd.nFactors)
-	// Stochastic Gradient Descent
-	for epoch := 0; epoch < svd.nEpochs; epoch++ {
-		for denseUserId := 0; denseUserId < trainSet.UserCount(); denseUserId++ {
-			base.FillZeroVector(step)
-			size := svd.UserRatings[denseUserId].Len()
-			scale := math.Pow(float64(size), -0.5)
-			sumFactor := svd.getSumFactors(denseUserId)
-			trainSet.DenseUserRatings[denseUserId].ForEach(func(i, denseItemId int, rating float64) {
-				userBias := svd.UserBias[denseUserId]
-				itemBias := svd.ItemBias[denseItemId]
-				copy(userFactor, svd.UserFactor[denseUserId])
-				copy(itemFactor, svd.ItemFactor[denseItemId])
-				// Compute error: e_{ui} = r - \hat r
-				pred := svd.predict(denseUserId, denseItemId, sumFactor)
-				diff := rating - pred
-				// Update user Bias: b_u <- b_u + \gamma (e_{ui} - \lambda b_u)
-				gradUserBias := diff - svd.reg*userBias
-				svd.UserBias[denseUserId] += svd.lr * gradUserBias
-				// Update item Bias: p_i <- p_i + \gamma (e_{ui} - \lambda b_i)
-				gradItemBias := diff - svd.reg*itemBias
-				svd.ItemBias[denseItemId] += svd.lr * gradItemBias
-				// Update user latent factor
-				copy(a, itemFactor)
-				base.MulConst(diff, a)
-				copy(b, userFactor)
-				base.MulConst(svd.reg, b)
-				floats.Sub(a, b)
-				base.MulConst(svd.lr, a)
-				floats.Add(svd.UserFactor[denseUserId], a)
-				// Update item latent factor
-				copy(a, userFactor)
-				floats.Add(a, sumFactor)
-				base.MulConst(diff, a)
-				copy(b, itemFactor)
-				base.MulConst(svd.reg, b)
-				floats.Sub(a, b)
-				base.MulConst(svd.lr, a)
-				floats.Add(svd.ItemFactor[denseItemId], a)
-				// Update implicit latent factor: e_{ui}q_j|I_u|^{-1/2}
-				copy(a, itemFactor)
-				base.MulConst(scale, a)
-				base.MulConst(diff, a)
-				floats.Add(step, a)
+	buffers := svd.newBuffers()
+	// SGD, or Hogwild SGD over shards of users if enabled
+	for epoch := svd.resume(svd); epoch < svd.nEpochs && !svd.canceled(); epoch++ {
+		svd.updaters.setEpoch(epoch)
+		loss := svd.parallelLoss(svd.sgdJobs(), trainSet.UserCount(), func(jobId, begin, end int) float64 {
+			loss := 0.0
+			for denseUserId := begin; denseUserId < end; denseUserId++ {
+				loss += svd.sgd(denseUserId, &trainSet.DenseUserRatings[denseUserId], buffers[jobId])
+			}
+			return loss
+		})
+		if svd.epochEnd(svd, epoch+1, loss/float64(trainSet.Len())) {
+			break
+		}
+	}
+}
+
+// fitMiniBatch optimizes by mini-batch SGD over users. Gradients of users in a
+// batch are computed in parallel and summed up (not averaged), then each
+// parameter is updated by the optimizer once per batch.
+func (svd *SVDpp) fitMiniBatch(trainSet core.DataSet) {
+	// Create gradients and buffers
+	userGrads := newGradients(svd.rtOptions.NJobs)
+	itemGrads := newGradients(svd.rtOptions.NJobs)
+	implGrads := newGradients(svd.rtOptions.NJobs)
+	buffers := svd.newBuffers()
+	for epoch := svd.resume(svd); epoch < svd.nEpochs && !svd.canceled(); epoch++ {
+		svd.updaters.setEpoch(epoch)
+		loss := 0.0
+		perm := svd.rng.Perm(trainSet.UserCount())
+		for low := 0; low < len(perm); low += svd.batchSize {
+			high := low + svd.batchSize
+			if high > len(perm) {
+				high = len(perm)
+			}
+			batch := perm[low:high]
+			loss += svd.parallelLoss(svd.rtOptions.NJobs, len(batch), func(jobId, begin, end int) float64 {
+				userGrad, itemGrad, implGrad := userGrads[jobId], itemGrads[jobId], implGrads[jobId]
+				a, step := buffers[jobId].a, buffers[jobId].step
+				loss := 0.0
+				for _, denseUserId := range batch[begin:end] {
+					base.FillZeroVector(step)
+					userFactor := svd.UserFactor[denseUserId]
+					scale := math.Pow(float64(svd.UserRatings[denseUserId].Len()), -0.5)
+					sumFactor := svd.getSumFactors(denseUserId)
+					svd.UserRatings[denseUserId].ForEach(func(_, denseItemId int, rating float64) {
+						itemFactor := svd.ItemFactor[denseItemId]
+						// Compute error: e_{ui} = r - \hat r
+						diff := rating - svd.predict(denseUserId, denseItemId, sumFactor)
+						loss += diff * diff
+						// Accumulate gradients of biases: e_{ui} - \lambda b
+						userGrad.addBias(denseUserId, diff-svd.reg*svd.UserBias[denseUserId])
+						itemGrad.addBias(denseItemId, diff-svd.reg*svd.ItemBias[denseItemId])
+						// Accumulate gradient of user latent factor: e_{ui} q_i - \lambda p_u
+						userGrad.addFactor(denseUserId, diff, itemFactor)
+						userGrad.addFactor(denseUserId, -svd.reg, userFactor)
+						// Accumulate gradient of item latent factor: e_{ui} (p_u + |I_u|^{-1/2} \sum y_j) - \lambda q_i
+						copy(a, userFactor)
+						floats.Add(a, sumFactor)
+						itemGrad.addFactor(denseItemId, diff, a)
+						itemGrad.addFactor(denseItemId, -svd.reg, itemFactor)
+						// Accumulate e_{ui} |I_u|^{-1/2} q_i
+						floats.AddScaled(step, diff*scale, itemFactor)
+					})
+					// Accumulate gradients of implicit latent factors: \sum e_{ui} |I_u|^{-1/2} q_i - \lambda y_j
+					svd.UserRatings[denseUserId].ForEach(func(_, denseItemId int, _ float64) {
+						implGrad.addFactor(denseItemId, 1, step)
+						implGrad.addFactor(denseItemId, -svd.reg, svd.ImplFactor[denseItemId])
+					})
+				}
+				return loss
 			})
-			// Update implicit latent factor
-			var wg sync.WaitGroup
-			wg.Add(svd.rtOptions.NJobs)
-			for j := 0; j < svd.rtOptions.NJobs; j++ {
-				go func(jobId int) {
-					low := size * jobId / svd.rtOptions.NJobs
-					high := size * (jobId + 1) / svd.rtOptions.NJobs
-					a := c[jobId]
-					b := d[jobId]
-					for i := low; i < high; i++ {
-						denseItemId := svd.UserRatings[denseUserId].Indices[i]
-						implFactor := svd.ImplFactor[denseItemId]
-						// a <- e_{ui}q_j|I_u|^{-1/2}
-						copy(a, step)
-						base.DivConst(float64(size), step)
-						// + \lambda y_k
-						copy(b, implFactor)
-						base.MulConst(svd.reg, b)
-						//MulConst(float64(size), b)
-						floats.Sub(a, b)
-						// \mu (e_{ui}q_j|I_u|^{-1/2} + \lambda y_k)
-						base.MulConst(svd.lr, a)
-						floats.Add(svd.ImplFactor[denseItemId], a)
-					}
-					wg.Done()
-				}(j)
+			// Sum up gradients of jobs and update parameters
+			userGrads[0].merge(userGrads[1:])
+			itemGrads[0].merge(itemGrads[1:])
+			implGrads[0].merge(implGrads[1:])
+			userGrads[0].apply(svd.updaters.userFactor, svd.UserFactor, svd.updaters.userBias, svd.UserBias)
+			itemGrads[0].apply(svd.updaters.itemFactor, svd.ItemFactor, svd.updaters.itemBias, svd.ItemBias)
+			implGrads[0].apply(svd.updaters.implFactor, svd.ImplFactor, nil, nil)
+		}
+		if svd.epochEnd(svd, epoch+1, loss/float64(trainSet.Len())) {
+			break
+		}
+	}
+}
+
+// svdppBuffer contains buffers used in SGD of SVD++. Each job owns a buffer in
+// Hogwild SGD.
+type svdppBuffer struct {
+	*sgdBuffer
+	step []float64
+}
+
+func (svd *SVDpp) newBuffers() []*svdppBuffer {
+	buffers := make([]*svdppBuffer, svd.rtOptions.NJobs)
+	for i := range buffers {
+		buffers[i] = &svdppBuffer{
+			sgdBuffer: newSGDBuffer(svd.nFactors),
+			step:      make([]float64, svd.nFactors),
+		}
+	}
+	return buffers
+}
+
+// sgd updates parameters by ratings of a user and returns the sum of squared errors.
+func (svd *SVDpp) sgd(denseUserId int, ratings *base.SparseVector, buffer *svdppBuffer) float64 {
+	a, b, step := buffer.a, buffer.b, buffer.step
+	userFactor, itemFactor := buffer.userFactor, buffer.itemFactor
+	loss := 0.0
+	base.FillZeroVector(step)
+	size := svd.UserRatings[denseUserId].Len()
+	scale := math.Pow(float64(size), -0.5)
+	sumFactor := svd.getSumFactors(denseUserId)
+	ratings.ForEach(func(i, denseItemId int, rating float64) {
+		userBias := svd.UserBias[denseUserId]
+		itemBias := svd.ItemBias[denseItemId]
+		copy(userFactor, svd.UserFactor[denseUserId])
+		copy(itemFactor, svd.ItemFactor[denseItemId])
+		// Compute error: e_{ui} = r - \hat r
+		pred := svd.predict(denseUserId, denseItemId, sumFactor)
+		diff := rating - pred
+		loss += diff * diff
+		// Update user Bias: b_u <- b_u + \gamma (e_{ui} - \lambda b_u)
+		buffer.bias[0] = diff - svd.reg*userBias
+		svd.updaters.userBias.Update(denseUserId, svd.UserBias[denseUserId:denseUserId+1], buffer.bias)
+		// Update item Bias: p_i <- p_i + \gamma (e_{ui} - \lambda b_i)
+		buffer.bias[0] = diff - svd.reg*itemBias
+		svd.updaters.itemBias.Update(denseItemId, svd.ItemBias[denseItemId:denseItemId+1], buffer.bias)
+		// Update user latent factor
+		copy(a, itemFactor)
+		base.MulConst(diff, a)
+		copy(b, userFactor)
+		base.MulConst(svd.reg, b)
+		floats.Sub(a, b)
+		svd.updaters.userFactor.Update(denseUserId, svd.UserFactor[denseUserId], a)
+		// Update item latent factor
+		copy(a, userFactor)
+		floats.Add(a, sumFactor)
+		base.MulConst(diff, a)
+		copy(b, itemFactor)
+		base.MulConst(svd.reg, b)
+		floats.Sub(a, b)
+		svd.updaters.itemFactor.Update(denseItemId, svd.ItemFactor[denseItemId], a)
+		// Update implicit latent factor: e_{ui}q_j|I_u|^{-1/2}
+		copy(a, itemFactor)
+		base.MulConst(scale, a)
+		base.MulConst(diff, a)
+		floats.Add(step, a)
+	})
+	// Update implicit latent factor
+	for _, denseItemId := range svd.UserRatings[denseUserId].Indices {
+		implFactor := svd.ImplFactor[denseItemId]
+		// a <- e_{ui}q_j|I_u|^{-1/2}
+		copy(a, step)
+		base.DivConst(float64(size), step)
+		// + \lambda y_k
+		copy(b, implFactor)
+		base.MulConst(svd.reg, b)
+		//MulConst(float64(size), b)
+		floats.Sub(a, b)
+		// \mu (e_{ui}q_j|I_u|^{-1/2} + \lambda y_k)
+		svd.updaters.implFactor.Update(denseItemId, svd.ImplFactor[denseItemId], a)
+	}
+	return loss
+}
+
+// PartialFit updates the model with new ratings by nEpochs passes of SGD. Unseen
+// users and items are added with random factors and zero biases. New ratings
+// are added to implicit feedback of users. Optimizers start from fresh states
+// in each call, where the learning rate is scheduled over nEpochs.
+func (svd *SVDpp) PartialFit(table core.Table, nEpochs int, options ...base.FitOption) {
+	denseUserIds, denseItemIds, ratings := svd.partialInit(table, options)
+	// Initialize new users and items
+	for len(svd.UserFactor) < svd.UserIdSet.Len() {
+		svd.UserFactor = append(svd.UserFactor, svd.rng.MakeNormalVector(svd.nFactors, svd.initMean, svd.initStdDev))
+		svd.UserBias = append(svd.UserBias, 0)
+	}
+	for len(svd.ItemFactor) < svd.ItemIdSet.Len() {
+		svd.ItemFactor = append(svd.ItemFactor, svd.rng.MakeNormalVector(svd.nFactors, svd.initMean, svd.initStdDev))
+		svd.ImplFactor = append(svd.ImplFactor, svd.rng.MakeNormalVector(svd.nFactors, svd.initMean, svd.initStdDev))
+		svd.ItemBias = append(svd.ItemBias, 0)
+	}
+	// Add new ratings to implicit feedback, where vectors are cloned since
+	// they might be shared with the training set.
+	userRatings := make([]base.SparseVector, svd.UserIdSet.Len())
+	copy(userRatings, svd.UserRatings)
+	newRatings := make([]*base.SparseVector, svd.UserIdSet.Len())
+	newUsers := make([]int, 0)
+	for i, denseUserId := range denseUserIds {
+		if newRatings[denseUserId] == nil {
+			newRatings[denseUserId] = base.NewSparseVector()
+			userRatings[denseUserId] = userRatings[denseUserId].Clone()
+			newUsers = append(newUsers, denseUserId)
+		}
+		newRatings[denseUserId].Add(denseItemIds[i], ratings[i])
+		userRatings[denseUserId].Add(denseItemIds[i], ratings[i])
+	}
+	svd.UserRatings = userRatings
+	sort.Ints(newUsers)
+	// SGD, or Hogwild SGD over shards of users if enabled
+	svd.initUpdaters(nEpochs)
+	buffers := svd.newBuffers()
+	for epoch := 0; epoch < nEpochs && !svd.canceled(); epoch++ {
+		svd.updaters.setEpoch(epoch)
+		loss := svd.parallelLoss(svd.sgdJobs(), len(newUsers), func(jobId, begin, end int) float64 {
+			loss := 0.0
+			for _, denseUserId := range newUsers[begin:end] {
+				loss += svd.sgd(denseUserId, newRatings[denseUserId], buffers[jobId])
 			}
-			//Wait all updates completed
-			wg.Wait()
+			return loss
+		})
+		if svd.epochEnd(svd, epoch+1, loss/float64(len(ratings))) {
+			break
 		}
 	}
+	svd.restoreBest(svd)
 }
 
 // WRMF[7] model for implicit feedback.
@@ -541,6 +1194,10 @@ type WRMF struct {
 	initMean   float64
 	initStdDev float64
 	alpha      float64
+	solver     base.ParamString
+	cgSteps    int
+	// Cache of Y^T Y + \lambda I for fold-in
+	itemGram *mat.SymDense
 }
 
 // NewWRMF creates a WRMF model. Parameters:
@@ -548,7 +1205,10 @@ type WRMF struct {
 //   NEpochs    - The number of training epochs. Default is 50.
 //   InitMean   - The mean of initial latent factors. Default is 0.
 //   InitStdDev - The standard deviation of initial latent factors. Default is 0.1.
-//   Reg        - The strength of regularization.
+//   Reg        - The strength of regularization. Default is 0.06.
+//   Alpha      - The confidence of a rating r is 1 + alpha * r. Default is 1.
+//   Solver     - The solver of least squares ('cholesky', 'cg'). Default is 'cholesky'.
+//   CGSteps    - The number of steps of the conjugate gradient solver. Default is 3.
 func NewWRMF(params base.Params) *WRMF {
 	mf := new(WRMF)
 	mf.SetParams(params)
@@ -562,6 +1222,14 @@ func (mf *WRMF) SetParams(params base.Params) {
 	mf.initMean = mf.Params.GetFloat64(base.InitMean, 0)
 	mf.initStdDev = mf.Params.GetFloat64(base.InitStdDev, 0.1)
 	mf.reg = mf.Params.GetFloat64(base.Reg, 0.06)
+	mf.alpha = mf.Params.GetFloat64(base.Alpha, 1)
+	mf.cgSteps = mf.Params.GetInt(base.CGSteps, 3)
+	// Setup solver
+	switch mf.solver = mf.Params.GetString(base.Solver, base.Cholesky); mf.solver {
+	case base.Cholesky, base.CG:
+	default:
+		panic(fmt.Sprintf("Unknown solver: %v", mf.solver))
+	}
 }
 
 func (mf *WRMF) Predict(userId, itemId int) float64 {
@@ -574,79 +1242,234 @@ func (mf *WRMF) Predict(userId, itemId int) float64 {
 		mf.ItemFactor.RowView(denseItemId))
 }
 
+// Recommend recommends top-n items to a user.
+func (mf *WRMF) Recommend(userId int, n int, options ...core.RecommendOption) ([]int, []float64) {
+	return core.RecommendByPredict(mf, userId, n, mf.ItemIdSet.SparseIds, options...)
+}
+
+// PredictItems predicts ratings given by a user to a list of items.
+func (mf *WRMF) PredictItems(userId int, itemIds []int) []float64 {
+	scores := make([]float64, len(itemIds))
+	denseUserId := mf.UserIdSet.ToDenseId(userId)
+	if len(itemIds) == 0 || denseUserId == base.NotId {
+		return scores
+	}
+	// y_i^T x_u
+	userFactor := mf.UserFactor.RawRowView(denseUserId)
+	for i, denseItemId := range mf.toDenseItemIds(itemIds) {
+		if denseItemId != base.NotId {
+			scores[i] = floats.Dot(userFactor, mf.ItemFactor.RawRowView(denseItemId))
+		}
+	}
+	return scores
+}
+
+// PredictAll predicts ratings given by a list of users to all items.
+func (mf *WRMF) PredictAll(userIds []int) ([]int, *mat.Dense) {
+	itemIds := mf.ItemIdSet.SparseIds
+	if len(userIds) == 0 || len(itemIds) == 0 {
+		return itemIds, nil
+	}
+	// Stack x_u
+	userFactors := mat.NewDense(len(userIds), mf.nFactors, nil)
+	for i, denseUserId := range mf.toDenseUserIds(userIds) {
+		if denseUserId != base.NotId {
+			userFactors.SetRow(i, mf.UserFactor.RawRowView(denseUserId))
+		}
+	}
+	// X Y^T
+	scores := mat.NewDense(len(userIds), len(itemIds), nil)
+	scores.Mul(userFactors, mf.ItemFactor.T())
+	return itemIds, scores
+}
+
+// SimilarItems returns top-n items most similar to an item by the cosine
+// similarity between item factors.
+func (mf *WRMF) SimilarItems(itemId int, n int) ([]int, []float64) {
+	return similarFactors(&mf.ItemIdSet, mf.ItemFactor, itemId, n)
+}
+
+// SimilarUsers returns top-n users most similar to a user by the cosine
+// similarity between user factors.
+func (mf *WRMF) SimilarUsers(userId int, n int) ([]int, []float64) {
+	return similarFactors(&mf.UserIdSet, mf.UserFactor, userId, n)
+}
+
 func (mf *WRMF) Fit(set core.DataSet, options ...base.FitOption) {
 	mf.Init(set, options)
+	mf.itemGram = nil
 	// Initialize
 	mf.UserFactor = mat.NewDense(set.UserCount(), mf.nFactors,
 		mf.rng.MakeNormalVector(set.UserCount()*mf.nFactors, mf.initMean, mf.initStdDev))
 	mf.ItemFactor = mat.NewDense(set.ItemCount(), mf.nFactors,
 		mf.rng.MakeNormalVector(set.ItemCount()*mf.nFactors, mf.initMean, mf.initStdDev))
-	// Create temporary matrix
-	temp1 := mat.NewDense(mf.nFactors, mf.nFactors, nil)
-	temp2 := mat.NewVecDense(mf.nFactors, nil)
-	a := mat.NewDense(mf.nFactors, mf.nFactors, nil)
-	c := mat.NewDense(mf.nFactors, mf.nFactors, nil)
-	p := mat.NewDense(set.UserCount(), set.ItemCount(), nil)
-	// Create regularization matrix
-	regs := make([]float64, mf.nFactors)
-	for i := range regs {
-		regs[i] = mf.reg
-	}
-	regI := mat.NewDiagDense(mf.nFactors, regs)
-	for ep := 0; ep < mf.nEpochs; ep++ {
-		// Recompute all user factors: x_u = (Y^T C^u Y + \lambda reg)^{-1} Y^T C^u p(u)
-		// Y^T Y
-		c.Mul(mf.ItemFactor.T(), mf.ItemFactor)
-		// X Y^T
-		p.Mul(mf.UserFactor, mf.ItemFactor.T())
-		for u := 0; u < set.UserCount(); u++ {
-			a.Copy(c)
-			b := mat.NewVecDense(mf.nFactors, nil)
-			set.DenseUserRatings[u].ForEach(func(_, index int, value float64) {
-				// Y^T (C^u-I) Y
-				weight := value
-				temp1.Outer(weight, mf.ItemFactor.RowView(index), mf.ItemFactor.RowView(index))
-				a.Add(a, temp1)
-				// Y^T C^u p(u)
-				temp2.ScaleVec(weight+1, mf.ItemFactor.RowView(index))
-				b.AddVec(b, temp2)
-			})
-			a.Add(a, regI)
-			if err := temp1.Inverse(a); err != nil {
-				log.Println(err)
-				panic("A")
-			}
-			temp2.MulVec(temp1, b)
-			mf.UserFactor.SetRow(u, temp2.RawVector().Data)
+	for ep := mf.resume(mf); ep < mf.nEpochs && !mf.canceled(); ep++ {
+		// Recompute all user factors: x_u = (Y^T C^u Y + \lambda I)^{-1} Y^T C^u p(u)
+		mf.solveAll(mf.UserFactor, mf.ItemFactor, set.DenseUserRatings)
+		// Recompute all item factors: y_i = (X^T C^i X + \lambda I)^{-1} X^T C^i p(i)
+		mf.solveAll(mf.ItemFactor, mf.UserFactor, set.DenseItemRatings)
+		if mf.epochEnd(mf, ep+1, mf.loss(set)) {
+			break
 		}
-		// Recompute all item factors: y_i = (X^T C^i X + \lambda reg)^{-1} X^T C^i p(i)
-		// X^T X
-		c.Mul(mf.UserFactor.T(), mf.UserFactor)
-		// X Y^T
-		p.Mul(mf.UserFactor, mf.ItemFactor.T())
-		for i := 0; i < set.ItemCount(); i++ {
-			a.Copy(c)
-			b := mat.NewVecDense(mf.nFactors, nil)
-			set.DenseItemRatings[i].ForEach(func(_, index int, value float64) {
-				// X^T (C^i-I) X
-				weight := value
-				temp1.Outer(weight, mf.UserFactor.RowView(index), mf.UserFactor.RowView(index))
-				a.Add(a, temp1)
-				// X^T C^i p(i)
-				temp2.ScaleVec(weight+1, mf.UserFactor.RowView(index))
-				b.AddVec(b, temp2)
-			})
-			a.Add(a, regI)
-			if err := temp1.Inverse(a); err != nil {
-				log.Println(err)
-				panic("B")
+	}
+	mf.restoreBest(mf)
+	mf.itemGram = mf.gram(mf.ItemFactor)
+}
+
+// gram computes Y^T Y + \lambda I, where Y is the fixed side of factors.
+func (mf *WRMF) gram(fixed *mat.Dense) *mat.SymDense {
+	gram := mat.NewSymDense(mf.nFactors, nil)
+	gram.SymOuterK(1, fixed.T())
+	for i := 0; i < mf.nFactors; i++ {
+		gram.SetSym(i, i, gram.At(i, i)+mf.reg)
+	}
+	return gram
+}
+
+// solveAll recomputes all rows of factors (dst) with the other side (fixed)
+// fixed, where ratings[i] are ratings of the i-th row. Rows are solved in
+// parallel, and the number of rows skipped by singular systems is logged.
+func (mf *WRMF) solveAll(dst, fixed *mat.Dense, ratings []base.SparseVector) {
+	gram := mf.gram(fixed)
+	var skipped int64
+	base.Parallel(len(ratings), mf.rtOptions.NJobs, func(begin, end int) {
+		solver := mf.newSolver()
+		for i := begin; i < end; i++ {
+			if !solver.solve(dst.RawRowView(i), fixed, gram, &ratings[i]) {
+				atomic.AddInt64(&skipped, 1)
 			}
-			temp2.MulVec(temp1, b)
-			mf.ItemFactor.SetRow(i, temp2.RawVector().Data)
 		}
+	})
+	if skipped > 0 {
+		log.Printf("WRMF: skip %d rows with singular systems", skipped)
+	}
+}
+
+// wrmfSolver solves a row of factors by least squares. Each job owns a solver.
+type wrmfSolver struct {
+	model *WRMF
+	a     *mat.SymDense
+	b     *mat.VecDense
+	x     *mat.VecDense
+	chol  mat.Cholesky
+	// Buffers of conjugate gradient
+	r  *mat.VecDense
+	p  *mat.VecDense
+	ap *mat.VecDense
+}
+
+func (mf *WRMF) newSolver() *wrmfSolver {
+	return &wrmfSolver{
+		model: mf,
+		a:     mat.NewSymDense(mf.nFactors, nil),
+		b:     mat.NewVecDense(mf.nFactors, nil),
+		x:     mat.NewVecDense(mf.nFactors, nil),
+		r:     mat.NewVecDense(mf.nFactors, nil),
+		p:     mat.NewVecDense(mf.nFactors, nil),
+		ap:    mat.NewVecDense(mf.nFactors, nil),
+	}
+}
+
+// solve solves x = (Y^T C Y + \lambda I)^{-1} Y^T C p and saves it to dst,
+// where gram is Y^T Y + \lambda I. dst is the initial value of conjugate
+// gradient, and it's kept if the system is singular, where false is returned.
+func (solver *wrmfSolver) solve(dst []float64, fixed *mat.Dense, gram *mat.SymDense, ratings *base.SparseVector) bool {
+	// Y^T C p = \sum_i c_i y_i
+	base.FillZeroVector(solver.b.RawVector().Data)
+	ratings.ForEach(func(_, index int, value float64) {
+		solver.b.AddScaledVec(solver.b, 1+solver.model.weight(value), fixed.RowView(index))
+	})
+	switch solver.model.solver {
+	case base.Cholesky:
+		// Y^T C Y + \lambda I = Y^T Y + \lambda I + Y^T (C-I) Y
+		solver.a.CopySym(gram)
+		ratings.ForEach(func(_, index int, value float64) {
+			solver.a.SymRankOne(solver.a, solver.model.weight(value), fixed.RowView(index))
+		})
+		if ok := solver.chol.Factorize(solver.a); !ok {
+			return false
+		}
+		// The solution is available even if the system is ill-conditioned
+		solver.chol.SolveVec(solver.x, solver.b)
+	case base.CG:
+		solver.x.CopyVec(mat.NewVecDense(len(dst), dst))
+		// r = b - Ax, p = r
+		solver.mulA(solver.r, solver.x, fixed, gram, ratings)
+		solver.r.SubVec(solver.b, solver.r)
+		solver.p.CopyVec(solver.r)
+		rr := mat.Dot(solver.r, solver.r)
+		for step := 0; step < solver.model.cgSteps && rr > 0; step++ {
+			// \alpha = r^T r / p^T A p
+			solver.mulA(solver.ap, solver.p, fixed, gram, ratings)
+			alpha := rr / mat.Dot(solver.p, solver.ap)
+			// x = x + \alpha p, r = r - \alpha Ap
+			solver.x.AddScaledVec(solver.x, alpha, solver.p)
+			solver.r.AddScaledVec(solver.r, -alpha, solver.ap)
+			// p = r + (r'^T r' / r^T r) p
+			newRR := mat.Dot(solver.r, solver.r)
+			solver.p.AddScaledVec(solver.r, newRR/rr, solver.p)
+			rr = newRR
+		}
+	}
+	copy(dst, solver.x.RawVector().Data)
+	return true
+}
+
+// mulA computes (Y^T C Y + \lambda I) v without forming the matrix, where gram
+// is Y^T Y + \lambda I.
+func (solver *wrmfSolver) mulA(dst, v *mat.VecDense, fixed *mat.Dense, gram *mat.SymDense, ratings *base.SparseVector) {
+	dst.MulVec(gram, v)
+	// + Y^T (C-I) Y v
+	ratings.ForEach(func(_, index int, value float64) {
+		y := fixed.RowView(index)
+		dst.AddScaledVec(dst, solver.model.weight(value)*mat.Dot(y, v), y)
+	})
+}
+
+// FoldIn solves the latent factor of a user by one least-squares solve of the
+// solver, where item factors are fixed:
+//   x_u = (Y^T C^u Y + \lambda I)^{-1} Y^T C^u p(u)
+// Y^T Y + \lambda I is computed after fitting, or at the first fold-in of a
+// loaded model.
+func (mf *WRMF) FoldIn(userId int, itemIds []int, ratings []float64) {
+	denseUserId, denseItemIds, ratings := mf.foldInUser(userId, itemIds, ratings)
+	userRatings := base.SparseVector{Indices: denseItemIds, Values: ratings}
+	userFactor := make([]float64, mf.nFactors)
+	if mf.itemGram == nil {
+		mf.itemGram = mf.gram(mf.ItemFactor)
+	}
+	mf.newSolver().solve(userFactor, mf.ItemFactor, mf.itemGram, &userRatings)
+	// Add a row for the new user
+	if rows, _ := mf.UserFactor.Dims(); denseUserId == rows {
+		userFactors := mat.NewDense(rows+1, mf.nFactors, nil)
+		userFactors.Slice(0, rows, 0, mf.nFactors).(*mat.Dense).Copy(mf.UserFactor)
+		mf.UserFactor = userFactors
+	}
+	mf.UserFactor.SetRow(denseUserId, userFactor)
+}
+
+// loss computes the weighted squared error \sum_{u,i} c_{ui}(p_{ui} - x_u^Ty_i)^2,
+// where the sum over all pairs is computed by \sum_{u,i} (x_u^Ty_i)^2 =
+// tr(X^TX Y^TY) and corrected on observed pairs.
+func (mf *WRMF) loss(set core.DataSet) float64 {
+	// \sum_{u,i} (x_u^Ty_i)^2
+	xtx := mat.NewDense(mf.nFactors, mf.nFactors, nil)
+	xtx.Mul(mf.UserFactor.T(), mf.UserFactor)
+	yty := mat.NewDense(mf.nFactors, mf.nFactors, nil)
+	yty.Mul(mf.ItemFactor.T(), mf.ItemFactor)
+	xtx.MulElem(xtx, yty)
+	loss := mat.Sum(xtx)
+	// + c_{ui}(1 - x_u^Ty_i)^2 - (x_u^Ty_i)^2 for observed pairs
+	for u := range set.DenseUserRatings {
+		set.DenseUserRatings[u].ForEach(func(_, index int, value float64) {
+			prediction := mat.Dot(mf.UserFactor.RowView(u), mf.ItemFactor.RowView(index))
+			loss += (1+mf.weight(value))*(1-prediction)*(1-prediction) - prediction*prediction
+		})
 	}
+	return loss / float64(set.UserCount()*set.ItemCount())
 }
 
+// weight returns c_{ui} - 1 = \alpha r_{ui}.
 func (mf *WRMF) weight(value float64) float64 {
 	return mf.alpha * value
 }